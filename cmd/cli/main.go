@@ -2,49 +2,150 @@ package main
 
 import (
 	"context"
-	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/input"
 	"github.com/vrnvu/go-sql/internal/query"
+	"github.com/vrnvu/go-sql/internal/ramp"
+	"github.com/vrnvu/go-sql/internal/scenario"
 	"github.com/vrnvu/go-sql/internal/workerpool"
 )
 
 func main() {
-	var inputPath string
+	var inputPaths stringsFlag
+	var inputFormat string
+	var generateSpec string
+	var mix string
+	var mixSeed int64
+	var mixHosts int
+	var filterHostname string
+	var sample float64
+	var limit int
+	var shuffle int
+	var seed int64
+	var loopTimes int
+	var loopDuration time.Duration
+	var templatePath string
+	var rejectsPath string
+	var tagColumns string
+	var delimiter string
+	var comment string
+	var timeFormats string
+	var timeZone string
+	var hostnamePattern string
+	var startBeforeEnd bool
+	var maxWindow time.Duration
+	var minTime string
+	var maxTime string
+	var errorMode string
+	var maxSkipped int
+	var maxSkippedRatio float64
+	var strategy string
+	var targetRate float64
+	var queueDepth int
 	var numWorkers int
 	var timeoutSeconds int
+	var gracePeriod time.Duration
+	var workerReport bool
+	var workStealing bool
+	var warmup time.Duration
+	var warmupQueries int
+	var duration time.Duration
+	var maxRate float64
+	var maxWorkerRate float64
+	var rateBurst int
+	var maxFailureRatio float64
+	var failureWindow int
+	var maxConsecutiveFailures int
 	var dbUser string
 	var dbPassword string
 	var dbHost string
 	var dbPort string
 	var dbName string
+	var scenarioPath string
+	var rampSpec string
+	var rampHold time.Duration
 
-	flag.StringVar(&inputPath, "input", "", "Path to input CSV (defaults to stdin)")
+	flag.Var(&inputPaths, "input", "Path, glob or directory of input CSV or NDJSON files, can be repeated and files may be gzip, zstd or bzip2 compressed (defaults to stdin)")
+	flag.StringVar(&inputFormat, "input-format", "", "Input format: csv, ndjson, or stderr and csvlog to replay PostgreSQL logs (defaults to the file extension, .ndjson and .jsonl are ndjson, otherwise csv)")
+	flag.StringVar(&generateSpec, "generate", "", "Generate a synthetic workload instead of reading -input, e.g. seed=42,count=5000,hosts=100,popularity=zipf")
+	flag.StringVar(&mix, "mix", "", "Weighted query types, e.g. single-host=5,max-per-minute=2,lastpoint=1,groupby-hosts=1,high-cpu=1 (defaults to single-host)")
+	flag.Int64Var(&mixSeed, "mix-seed", 1, "Seed of the -mix query type picks")
+	flag.IntVar(&mixHosts, "mix-hosts", 8, "Number of hosts queried by lastpoint and groupby-hosts queries")
+	flag.StringVar(&filterHostname, "filter-hostname", "", "Only run queries whose hostname matches this shell pattern, e.g. host_00001*")
+	flag.Float64Var(&sample, "sample", 0, "Only run a random fraction of the queries, e.g. 0.1 for 10% (disabled by default)")
+	flag.IntVar(&limit, "limit", 0, "Only run the first n queries, after -filter-hostname and -sample (disabled by default)")
+	flag.IntVar(&shuffle, "shuffle", 0, "Shuffle queries through a buffer of n queries, a buffer larger than the input is a full shuffle (disabled by default)")
+	flag.Int64Var(&seed, "seed", 1, "Seed of -sample and -shuffle")
+	flag.IntVar(&loopTimes, "loop", 0, "Read the input n times, 0 loops until -loop-duration when it is set (disabled by default)")
+	flag.DurationVar(&loopDuration, "loop-duration", 0, "Read the input again and again until this duration has passed, e.g. 30m (disabled by default)")
+	flag.StringVar(&templatePath, "template", "", "Path to a SQL template with {{column}} placeholders (defaults to the cpu_usage query)")
+	flag.StringVar(&tagColumns, "tag-columns", "", "Comma separated input columns to break down metrics by, e.g. dashboard,tenant (disabled by default)")
+	flag.StringVar(&rejectsPath, "rejects", "", "Path to write skipped input rows to as CSV with line, reason, error and the original record (disabled by default)")
+	flag.StringVar(&delimiter, "delimiter", ",", "Input CSV field delimiter, a single character or \\t for tabs")
+	flag.StringVar(&comment, "comment", "", "Input CSV comment character, lines starting with it are ignored (disabled by default)")
+	flag.StringVar(&timeFormats, "time-format", query.FormatDateTime, "Comma separated timestamp formats tried in order: datetime, rfc3339, unix, unix_ms or a Go layout")
+	flag.StringVar(&timeZone, "time-zone", "UTC", "Time zone of input timestamps without an offset, e.g. America/New_York")
+	flag.StringVar(&hostnamePattern, "hostname-pattern", "", "Skip rows whose hostname does not fully match this regular expression, e.g. host_[0-9]{6}")
+	flag.BoolVar(&startBeforeEnd, "start-before-end", false, "Skip rows where start_time is after end_time (disabled by default)")
+	flag.DurationVar(&maxWindow, "max-window", 0, "Skip rows where end_time - start_time is longer than this duration, e.g. 24h (disabled by default)")
+	flag.StringVar(&minTime, "min-time", "", "Skip rows with timestamps before the dataset start, in -time-format (disabled by default)")
+	flag.StringVar(&maxTime, "max-time", "", "Skip rows with timestamps after the dataset end, in -time-format (disabled by default)")
+	flag.StringVar(&errorMode, "error-policy", string(workerpool.ErrorLenient), "What to do with bad input rows: lenient skips them, strict aborts on the first one, threshold aborts past -max-skipped or -max-skipped-ratio")
+	flag.IntVar(&maxSkipped, "max-skipped", 0, "Number of skipped rows allowed with -error-policy threshold (disabled by default)")
+	flag.Float64Var(&maxSkippedRatio, "max-skipped-ratio", 0, "Ratio of skipped to read rows allowed with -error-policy threshold, e.g. 0.01 (disabled by default)")
+	flag.Float64Var(&maxFailureRatio, "max-failure-ratio", 0, "Abort once the failed share of the last -failure-window queries is above this ratio, e.g. 0.5 (disabled by default)")
+	flag.IntVar(&failureWindow, "failure-window", workerpool.DefaultFailureWindow, "Number of recent queries -max-failure-ratio is checked over")
+	flag.IntVar(&maxConsecutiveFailures, "max-consecutive-failures", 0, "Abort once this many queries in a row failed, e.g. 50 (disabled by default)")
 	flag.IntVar(&numWorkers, "workers", 0, "Number of workers to use")
+	flag.IntVar(&queueDepth, "queue-depth", workerpool.DefaultQueueDepth, "Number of queries queued per worker, reading the input waits while the queue is full")
+	flag.BoolVar(&workStealing, "work-stealing", false, "Let idle workers take queued queries from the busiest worker, for strategies with a queue per worker")
+	flag.BoolVar(&workerReport, "worker-report", false, "Print the load of each worker and how skewed the load is across workers")
+	flag.Float64Var(&targetRate, "rate", 0, "Target queries per second, each query is sent at its intended start and latency is also reported from it (disabled by default)")
+	flag.Float64Var(&maxRate, "max-rate", 0, "Cap the queries per second of all workers together, closed loop unlike -rate (disabled by default)")
+	flag.Float64Var(&maxWorkerRate, "max-worker-rate", 0, "Cap the queries per second of each worker (disabled by default)")
+	flag.IntVar(&rateBurst, "rate-burst", 1, "Number of queries -max-rate and -max-worker-rate let through at once after being idle")
+	flag.StringVar(&strategy, "strategy", string(workerpool.StrategySticky), "How queries are assigned to workers: sticky, hash, round-robin, least-outstanding or shared")
+	flag.DurationVar(&warmup, "warmup", 0, "Run queries for this long before measuring, they are kept out of the metrics, e.g. 30s (disabled by default)")
+	flag.IntVar(&warmupQueries, "warmup-queries", 0, "Run this many queries before measuring, they are kept out of the metrics (disabled by default)")
+	flag.DurationVar(&duration, "duration", 0, "Measure for this long after the warmup, the input is read again as needed, e.g. 5m (defaults to the end of the input)")
 	flag.IntVar(&timeoutSeconds, "timeout", 600, "Timeout in seconds (defaults to 600 seconds)")
+	flag.DurationVar(&gracePeriod, "grace-period", workerpool.DefaultGracePeriod, "How long the queries in flight have to finish after the timeout, Ctrl-C or SIGTERM before they are cancelled")
 	flag.StringVar(&dbUser, "db-user", "tigerdata", "Database username")
 	flag.StringVar(&dbPassword, "db-password", "123", "Database password")
 	flag.StringVar(&dbHost, "db-host", "localhost", "Database host")
 	flag.StringVar(&dbPort, "db-port", "5432", "Database port")
 	flag.StringVar(&dbName, "db-name", "homework", "Database name")
+	flag.StringVar(&rampSpec, "ramp", "", "Raise the load in steps to find the saturation point, e.g. workers=8,16,32,64 or rate=100,200,400 with -workers workers (disabled by default)")
+	flag.DurationVar(&rampHold, "ramp-hold", 30*time.Second, "Duration of each -ramp step")
+	flag.StringVar(&scenarioPath, "scenario", "", "Path to a JSON scenario file with setup, warmup, phases and teardown, the -db flags are the connection defaults")
 	flag.Parse()
 
-	var reader *csv.Reader
-	if inputPath == "" {
-		log.Println("input path is empty, reading from stdin")
-		reader = csv.NewReader(os.Stdin)
-	} else {
-		file, err := os.Open(inputPath)
-		if err != nil {
-			log.Fatalf("error opening input file: %v", err)
+	if scenarioPath != "" {
+		runScenario(scenarioPath, timeoutSeconds, scenario.Connection{User: dbUser, Password: dbPassword, Host: dbHost, Port: dbPort, Database: dbName})
+		return
+	}
+
+	var err error
+	var rampSteps ramp.Spec
+	if rampSpec != "" {
+		if rampSteps, err = ramp.ParseSpec(rampSpec, rampHold); err != nil {
+			flag.Usage()
+			log.Fatalf("%v", err)
 		}
-		defer file.Close()
-		reader = csv.NewReader(file)
+		// the client needs a connection per worker of the largest step
+		numWorkers = rampSteps.MaxWorkers(numWorkers)
 	}
 
 	if numWorkers < 1 || workerpool.MaxWorkers < numWorkers {
@@ -56,13 +157,170 @@ func main() {
 		flag.Usage()
 		log.Fatalf("timeout must be greater than 0")
 	}
+	if rampSpec != "" && rampSteps.Duration() > time.Duration(timeoutSeconds)*time.Second {
+		log.Printf("warning: the ramp steps take %v, more than the timeout of %ds", rampSteps.Duration(), timeoutSeconds)
+	}
+	if rampSpec != "" && (duration > 0 || warmup > 0 || warmupQueries > 0) {
+		flag.Usage()
+		log.Fatalf("-duration, -warmup and -warmup-queries can not be used with -ramp, use -ramp-hold")
+	}
+	if warmup+duration > time.Duration(timeoutSeconds)*time.Second {
+		log.Printf("warning: the warmup and duration take %v, more than the timeout of %ds", warmup+duration, timeoutSeconds)
+	}
 
-	queryReader, err := query.NewQueryReader(reader)
-	if err != nil {
-		log.Fatalf("error reading query headers: %v", err)
+	options := query.Options{}
+	if options.Delimiter, err = parseRune(delimiter); err != nil || options.Delimiter == 0 {
+		flag.Usage()
+		log.Fatalf("invalid delimiter %q: must be a single character", delimiter)
+	}
+	if options.Comment, err = parseRune(comment); err != nil {
+		flag.Usage()
+		log.Fatalf("invalid comment %q: must be a single character", comment)
+	}
+	options.TimeFormats = splitList(timeFormats)
+	if tagColumns != "" {
+		options.TagColumns = splitList(tagColumns)
+	}
+	if options.Location, err = time.LoadLocation(timeZone); err != nil {
+		flag.Usage()
+		log.Fatalf("invalid time zone %q: %v", timeZone, err)
+	}
+	if options.Validation, err = parseValidation(options, hostnamePattern, startBeforeEnd, maxWindow, minTime, maxTime); err != nil {
+		flag.Usage()
+		log.Fatalf("invalid validation rules: %v", err)
+	}
+	if templatePath != "" {
+		if options.Template, err = parseTemplate(templatePath); err != nil {
+			log.Fatalf("error reading template: %v", err)
+		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	// openInput opens a pass of the workload, it is called again for every -loop pass
+	var openInput query.LoopOpener
+	switch {
+	case generateSpec != "":
+		openInput = func() (query.Reader, io.Closer, error) {
+			generator, err := newGenerator(generateSpec)
+			return generator, nil, err
+		}
+	case len(inputPaths) == 0:
+		log.Println("input path is empty, reading from stdin")
+		if inputFormat == "" {
+			inputFormat = query.FormatCSV
+		}
+		openInput = func() (query.Reader, io.Closer, error) {
+			stdin, err := input.NewReader(os.Stdin, "")
+			if err != nil {
+				return nil, nil, fmt.Errorf("error decompressing stdin: %w", err)
+			}
+			reader, err := query.NewReader(stdin, inputFormat, options)
+			return reader, nil, err
+		}
+	default:
+		paths, err := input.Expand(inputPaths)
+		if err != nil {
+			log.Fatalf("error finding input files: %v", err)
+		}
+		openInput = func() (query.Reader, io.Closer, error) {
+			multiReader, err := query.NewMultiReader(paths, func(path string) (query.Reader, io.Closer, error) {
+				return openQueryReader(path, inputFormat, options)
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+			return multiReader, multiReader, nil
+		}
+	}
+
+	var rejectsReader *query.RejectsReader
+	if rejectsPath != "" {
+		rejectsFile, err := os.Create(rejectsPath) //nolint:gosec
+		if err != nil {
+			log.Fatalf("error creating rejects file: %v", err)
+		}
+		defer rejectsFile.Close()
+
+		// every -loop pass reads the same rows again, only the rejects of the first pass are written
+		openPass := openInput
+		openInput = func() (query.Reader, io.Closer, error) {
+			reader, closer, err := openPass()
+			if err != nil || rejectsReader != nil {
+				return reader, closer, err
+			}
+			if rejectsReader, err = query.NewRejectsReader(reader, rejectsFile); err != nil {
+				if closer != nil {
+					closer.Close()
+				}
+				return nil, nil, fmt.Errorf("error creating rejects file: %w", err)
+			}
+			return rejectsReader, closer, nil
+		}
+	}
+	// reportRejects is also called before exiting on a failed run, when the rejects matter the most
+	reportRejects := func() {
+		if rejectsReader == nil {
+			return
+		}
+		if err := rejectsReader.Err(); err != nil {
+			log.Printf("warning: rejects file is incomplete: %v", err)
+		}
+		log.Printf("wrote %d rejected rows to %s", rejectsReader.Rejected(), rejectsPath)
+	}
+
+	if duration > 0 && generateSpec == "" && len(inputPaths) == 0 {
+		flag.Usage()
+		log.Fatalf("-duration can not read stdin again, use -input")
+	}
+
+	var queryReader query.Reader
+	if (rampSpec != "" || duration > 0) && loopTimes == 0 && loopDuration == 0 && (generateSpec != "" || len(inputPaths) > 0) {
+		// the steps or the duration end the run, the input is read again until then
+		loopReader, err := query.NewLoopReader(openInput, 0, 0)
+		if err != nil {
+			log.Fatalf("error opening input: %v", err)
+		}
+		defer loopReader.Close()
+		queryReader = loopReader
+	} else if loopTimes > 0 || loopDuration > 0 {
+		if generateSpec == "" && len(inputPaths) == 0 {
+			flag.Usage()
+			log.Fatalf("-loop and -loop-duration can not read stdin again, use -input")
+		}
+		loopReader, err := query.NewLoopReader(openInput, loopTimes, loopDuration)
+		if err != nil {
+			log.Fatalf("error opening input: %v", err)
+		}
+		defer loopReader.Close()
+		queryReader = loopReader
+	} else {
+		reader, closer, err := openInput()
+		if err != nil {
+			log.Fatalf("error opening input: %v", err)
+		}
+		if closer != nil {
+			defer closer.Close()
+		}
+		queryReader = reader
+	}
+
+	if queryReader, err = newDecorators(queryReader, filterHostname, sample, limit, shuffle, seed); err != nil {
+		flag.Usage()
+		log.Fatalf("invalid input selection: %v", err)
+	}
+
+	if mix != "" {
+		if options.Template != nil {
+			flag.Usage()
+			log.Fatalf("-mix and -template can not be used together")
+		}
+		queryReader, err = newMixReader(queryReader, mix, mixSeed, mixHosts)
+		if err != nil {
+			flag.Usage()
+			log.Fatalf("error creating query mix: %v", err)
+		}
+	}
+
+	ctx, cancel := newRunContext(timeoutSeconds)
 	defer cancel()
 
 	client, err := client.NewTigerData(ctx, numWorkers, dbUser, dbPassword, dbHost, dbPort, dbName)
@@ -75,14 +333,262 @@ func main() {
 		log.Fatalf("error pinging client: %v", err)
 	}
 
-	wp, err := workerpool.New(numWorkers, client, queryReader)
+	errorPolicy := workerpool.ErrorPolicy{Mode: workerpool.ErrorMode(errorMode), MaxSkipped: maxSkipped, MaxSkippedRatio: maxSkippedRatio}
+	poolOptions := workerpool.Options{
+		ErrorPolicy:    errorPolicy,
+		Strategy:       workerpool.Strategy(strategy),
+		QueueDepth:     queueDepth,
+		GracePeriod:    gracePeriod,
+		TargetRate:     targetRate,
+		WorkStealing:   workStealing,
+		Warmup:         warmup,
+		WarmupQueries:  warmupQueries,
+		Duration:       duration,
+		MaxRate:        maxRate,
+		MaxWorkerRate:  maxWorkerRate,
+		RateLimitBurst: rateBurst,
+		CircuitBreaker: workerpool.CircuitBreaker{
+			MaxFailureRatio:        maxFailureRatio,
+			FailureWindow:          failureWindow,
+			MaxConsecutiveFailures: maxConsecutiveFailures,
+		},
+	}
+	if rampSpec != "" {
+		report, err := ramp.Run(ctx, rampSteps, client, queryReader, numWorkers, poolOptions)
+		// the report holds the steps run before a failure
+		fmt.Printf("%v\n", report.Table())
+		reportRejects()
+		if err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		return
+	}
+
+	wp, err := workerpool.NewWithOptions(numWorkers, client, queryReader, poolOptions)
 	if err != nil {
+		flag.Usage()
 		log.Fatalf("error creating worker pool: %v", err)
 	}
 
 	metrics, err := wp.Run(ctx)
+	if errors.Is(err, workerpool.ErrSkippedRows) || errors.Is(err, workerpool.ErrDatabaseUnhealthy) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// the metrics of the queries run before the abort or the interruption are partial but not lost
+		fmt.Printf("%v\n", metrics.Table())
+		if workerReport {
+			fmt.Printf("%v\n", metrics.WorkersTable())
+		}
+	}
+	reportRejects()
 	if err != nil {
 		log.Fatalf("error: %v", err)
 	}
 	fmt.Printf("%v\n", metrics.Table())
+	if workerReport {
+		fmt.Printf("%v\n", metrics.WorkersTable())
+	}
+}
+
+// stringsFlag is a flag that can be repeated
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// openQueryReader opens an input file and creates its query reader, the format defaults to the file extension
+func openQueryReader(path string, format string, options query.Options) (query.Reader, io.Closer, error) {
+	file, err := input.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if format == "" {
+		format = input.Format(path)
+	}
+
+	reader, err := query.NewReader(file, format, options)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+
+	return reader, file, nil
+}
+
+// newGenerator creates a synthetic workload generator from the -generate spec
+func newGenerator(generateSpec string) (*query.Generator, error) {
+	spec, err := query.ParseGeneratorSpec(generateSpec)
+	if err != nil {
+		return nil, err
+	}
+	return query.NewGenerator(spec)
+}
+
+// newDecorators applies the input selection flags in order: filter, sample, limit and shuffle
+func newDecorators(reader query.Reader, filterHostname string, sample float64, limit int, shuffle int, seed int64) (query.Reader, error) {
+	var err error
+	if filterHostname != "" {
+		keep, err := query.HostnameGlob(filterHostname)
+		if err != nil {
+			return nil, err
+		}
+		reader = query.NewFilterReader(reader, keep)
+	}
+	if sample != 0 {
+		if reader, err = query.NewSampleReader(reader, sample, seed); err != nil {
+			return nil, err
+		}
+	}
+	if limit != 0 {
+		if reader, err = query.NewLimitReader(reader, limit); err != nil {
+			return nil, err
+		}
+	}
+	if shuffle != 0 {
+		if reader, err = query.NewShuffleReader(reader, shuffle, seed); err != nil {
+			return nil, err
+		}
+	}
+
+	return reader, nil
+}
+
+// newMixReader assigns a query type of the -mix to every query of the reader
+func newMixReader(reader query.Reader, value string, seed int64, groupHosts int) (*query.MixReader, error) {
+	mix, err := query.ParseMix(value)
+	if err != nil {
+		return nil, err
+	}
+	return query.NewMixReader(reader, mix, seed, groupHosts)
+}
+
+// parseTemplate reads and parses the SQL template file
+func parseTemplate(templatePath string) (*query.Template, error) {
+	content, err := os.ReadFile(templatePath) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("error reading template file: %w", err)
+	}
+
+	return query.ParseTemplate(string(content))
+}
+
+// parseValidation builds the row validation rules, dataset bounds are parsed with the input time formats
+func parseValidation(options query.Options, hostnamePattern string, startBeforeEnd bool, maxWindow time.Duration, minTime, maxTime string) (query.Validation, error) {
+	validation := query.Validation{StartBeforeEnd: startBeforeEnd, MaxWindow: maxWindow}
+
+	if hostnamePattern != "" {
+		pattern, err := regexp.Compile("^(?:" + hostnamePattern + ")$")
+		if err != nil {
+			return query.Validation{}, fmt.Errorf("invalid hostname pattern: %w", err)
+		}
+		validation.HostnamePattern = pattern
+	}
+
+	times, err := query.NewTimeParser(options.TimeFormats, options.Location)
+	if err != nil {
+		return query.Validation{}, err
+	}
+	if minTime != "" {
+		if validation.MinTime, err = times.Parse(minTime); err != nil {
+			return query.Validation{}, fmt.Errorf("invalid min time: %w", err)
+		}
+	}
+	if maxTime != "" {
+		if validation.MaxTime, err = times.Parse(maxTime); err != nil {
+			return query.Validation{}, fmt.Errorf("invalid max time: %w", err)
+		}
+	}
+
+	return validation, nil
+}
+
+// splitList splits a comma separated flag, spaces around each entry are ignored, e.g. "datetime, rfc3339"
+func splitList(value string) []string {
+	entries := strings.Split(value, ",")
+	for i, entry := range entries {
+		entries[i] = strings.TrimSpace(entry)
+	}
+	return entries
+}
+
+// parseRune parses a single character flag, empty means disabled
+func parseRune(value string) (rune, error) {
+	if value == `\t` {
+		return '\t', nil
+	}
+
+	runes := []rune(value)
+	switch len(runes) {
+	case 0:
+		return 0, nil
+	case 1:
+		return runes[0], nil
+	default:
+		return 0, fmt.Errorf("expected a single character, got %q", value)
+	}
+}
+
+// newRunContext is done after the timeout or on the first SIGINT or SIGTERM, runs then return their partial results
+// A second signal kills the process, in case the grace period is too long to wait for
+func newRunContext(timeoutSeconds int) (context.Context, context.CancelFunc) {
+	ctx, cancelTimeout := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		// restores the default behavior of the signals
+		stop()
+	}()
+
+	return ctx, func() {
+		stop()
+		cancelTimeout()
+	}
+}
+
+// runScenario runs every phase of a scenario file and prints the combined report
+// Empty connection fields of the scenario default to the -db flags
+func runScenario(path string, timeoutSeconds int, defaults scenario.Connection) {
+	loaded, err := scenario.Load(path)
+	if err != nil {
+		log.Fatalf("error loading scenario: %v", err)
+	}
+
+	ctx, cancel := newRunContext(timeoutSeconds)
+	defer cancel()
+
+	newClient := func(ctx context.Context, connection scenario.Connection, workers int) (scenario.Client, error) {
+		tigerData, err := client.NewTigerData(ctx, workers,
+			withDefault(connection.User, defaults.User),
+			withDefault(connection.Password, defaults.Password),
+			withDefault(connection.Host, defaults.Host),
+			withDefault(connection.Port, defaults.Port),
+			withDefault(connection.Database, defaults.Database))
+		if err != nil {
+			return nil, err
+		}
+		if err := tigerData.Ping(ctx); err != nil {
+			_ = tigerData.Close()
+			return nil, fmt.Errorf("error pinging client: %w", err)
+		}
+		return tigerData, nil
+	}
+
+	report, err := scenario.NewRunner(loaded, newClient).Run(ctx)
+	// the report holds the phases run before a failure
+	fmt.Printf("%v\n", report.Table())
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+func withDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/vrnvu/go-sql/internal/input"
+	"github.com/vrnvu/go-sql/internal/query"
+)
+
+// Import the cpu_usage queries of PostgreSQL logs as a query_params.csv workload
+func main() {
+	var format string
+	var outputPath string
+	var timing bool
+
+	flag.StringVar(&format, "format", "", "Log format: stderr or csvlog (defaults to csvlog for .csv files, otherwise stderr)")
+	flag.StringVar(&outputPath, "output", "", "Path to the output CSV (defaults to stdout)")
+	flag.BoolVar(&timing, "timing", false, "Add the log_time and duration_ms columns of each statement")
+	flag.Parse()
+
+	paths, err := input.Expand(flag.Args())
+	if err != nil || len(paths) == 0 {
+		flag.Usage()
+		log.Fatalf("expected PostgreSQL log files, globs or directories as arguments: %v", err)
+	}
+
+	var output io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath) //nolint:gosec
+		if err != nil {
+			log.Fatalf("error creating output file: %v", err)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	var extra []string
+	if timing {
+		extra = []string{"log_time", "duration_ms"}
+	}
+	writer, err := query.NewCSVWriter(output, extra...)
+	if err != nil {
+		log.Fatalf("error writing output: %v", err)
+	}
+
+	written, skipped, ignored := 0, 0, 0
+	for _, path := range paths {
+		reader, closer, err := openLog(path, format)
+		if err != nil {
+			log.Fatalf("error opening %s: %v", path, err)
+		}
+
+		for {
+			q, hasMore, err := reader.Next()
+			if err != nil {
+				log.Printf("warning: skipped statement: %s: %v", path, err)
+				skipped++
+			} else if hasMore {
+				if err := writer.Write(q); err != nil {
+					log.Fatalf("error writing output: %v", err)
+				}
+				written++
+			}
+			if !hasMore {
+				break
+			}
+		}
+
+		ignored += reader.Ignored()
+		_ = closer.Close()
+	}
+
+	if err := writer.Flush(); err != nil {
+		log.Fatalf("error writing output: %v", err)
+	}
+	log.Printf("imported %d queries, skipped %d invalid and ignored %d other statements", written, skipped, ignored)
+}
+
+// openLog opens a possibly compressed log file, the format defaults to the file extension
+func openLog(path string, format string) (*query.PGLogReader, io.Closer, error) {
+	if format == "" {
+		format = string(query.PGLogStderr)
+		if filepath.Ext(input.TrimExtension(path)) == ".csv" {
+			format = string(query.PGLogCSV)
+		}
+	}
+	logFormat, err := query.ParsePGLogFormat(format)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := input.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := query.NewPGLogReader(file, logFormat, query.Options{PassThrough: true, Validation: query.Validation{StartBeforeEnd: true}})
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+
+	return reader, file, nil
+}
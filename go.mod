@@ -4,6 +4,8 @@ go 1.25.3
 
 require (
 	github.com/gkampitakis/go-snaps v0.5.15
+	github.com/jackc/pgx/v5 v5.7.6
+	github.com/klauspost/compress v1.20.1
 	github.com/stretchr/testify v1.11.1
 	pgregory.net/rapid v1.2.0
 )
@@ -15,7 +17,6 @@ require (
 	github.com/goccy/go-yaml v1.18.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
-	github.com/jackc/pgx/v5 v5.7.6 // indirect
 	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
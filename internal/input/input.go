@@ -0,0 +1,206 @@
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression format of an input stream
+type Compression string
+
+const (
+	// CompressionNone is a plain text input
+	CompressionNone Compression = "none"
+	// CompressionGzip is a .gz input
+	CompressionGzip Compression = "gzip"
+	// CompressionZstd is a .zst input
+	CompressionZstd Compression = "zstd"
+	// CompressionBzip2 is a .bz2 input
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// extensions maps file extensions to their compression
+var extensions = map[string]Compression{
+	".gz":   CompressionGzip,
+	".gzip": CompressionGzip,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+	".bz2":  CompressionBzip2,
+}
+
+// magics are the leading bytes of each compression format
+var magics = []struct {
+	compression Compression
+	magic       []byte
+}{
+	{CompressionGzip, []byte{0x1f, 0x8b}},
+	{CompressionZstd, []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{CompressionBzip2, []byte("BZh")},
+}
+
+// Open opens an input file and decompresses it transparently
+// The compression is detected by the file extension, or by the magic bytes for files without a known extension
+func Open(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+
+	compression, _ := FromExtension(path)
+	reader, err := NewReader(file, compression)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("error decompressing %s: %w", path, err)
+	}
+
+	return &readCloser{Reader: reader, closers: []io.Closer{reader, file}}, nil
+}
+
+// NewReader decompresses the reader, an empty compression is detected by the magic bytes
+func NewReader(reader io.Reader, compression Compression) (io.ReadCloser, error) {
+	if compression == "" {
+		buffered := bufio.NewReader(reader)
+		// Peek returns fewer bytes and an error for inputs shorter than the longest magic, those are plain text
+		header, _ := buffered.Peek(4)
+		compression = Detect(header)
+		reader = buffered
+	}
+
+	switch compression {
+	case CompressionGzip:
+		return gzip.NewReader(reader)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case CompressionBzip2:
+		return io.NopCloser(bzip2.NewReader(reader)), nil
+	case CompressionNone:
+		return io.NopCloser(reader), nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+}
+
+// Detect returns the compression of a stream starting with header
+func Detect(header []byte) Compression {
+	for _, m := range magics {
+		if bytes.HasPrefix(header, m.magic) {
+			return m.compression
+		}
+	}
+	return CompressionNone
+}
+
+// FromExtension returns the compression of a known compressed file extension
+func FromExtension(path string) (Compression, bool) {
+	compression, ok := extensions[strings.ToLower(filepath.Ext(path))]
+	return compression, ok
+}
+
+// TrimExtension removes the compression extension of the path, e.g. queries.csv.gz is queries.csv
+func TrimExtension(path string) string {
+	if _, ok := FromExtension(path); ok {
+		return strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	return path
+}
+
+// Format returns the query input format of a file extension, ignoring the compression extension
+// .ndjson and .jsonl files are ndjson, anything else is csv
+func Format(path string) string {
+	switch strings.ToLower(filepath.Ext(TrimExtension(path))) {
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	default:
+		return "csv"
+	}
+}
+
+// Expand resolves input paths, globs and directories to the list of input files
+// Directories are expanded to the files they contain, hidden files and subdirectories are ignored
+// Files are returned in the order of the patterns, globs and directories are sorted by name
+func Expand(patterns []string) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, `*?[\`) {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				return nil, fmt.Errorf("invalid input pattern %q: %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no input files match %q", pattern)
+			}
+		}
+
+		for _, match := range matches {
+			files, err := expandPath(match)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, files...)
+		}
+	}
+
+	return paths, nil
+}
+
+// expandPath returns the path itself for files, or the files of a directory
+func expandPath(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		files = append(files, filepath.Join(path, entry.Name()))
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no input files in directory %s", path)
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+// readCloser closes the decompressor and then the file
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var errs []error
+	for _, closer := range r.closers {
+		if err := closer.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCSV = "hostname,start_time,end_time\nhost_000001,2017-01-01 08:59:22,2017-01-01 09:59:22\n"
+
+func gzipped(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err := writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func zstded(t *testing.T, content string) []byte {
+	var buffer bytes.Buffer
+	writer, err := zstd.NewWriter(&buffer)
+	assert.NoError(t, err)
+	_, err = writer.Write([]byte(content))
+	assert.NoError(t, err)
+	assert.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+func readAll(t *testing.T, path string) string {
+	reader, err := Open(path)
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestOpenDecompresses(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"plain.csv":       []byte(testCSV),
+		"queries.csv.gz":  gzipped(t, testCSV),
+		"queries.csv.zst": zstded(t, testCSV),
+		// no known extension, detected by the magic bytes
+		"gzip.csv": gzipped(t, testCSV),
+		"zstd.csv": zstded(t, testCSV),
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), content, 0o600))
+	}
+
+	for name := range files {
+		assert.Equal(t, testCSV, readAll(t, filepath.Join(dir, name)), name)
+	}
+
+	expected, err := os.ReadFile("../../resources/query_params.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), readAll(t, "../../resources/query_params.csv.bz2"))
+}
+
+func TestOpenInvalidCompressedFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "queries.csv.gz")
+	assert.NoError(t, os.WriteFile(path, []byte(testCSV), 0o600))
+
+	_, err := Open(path)
+	assert.ErrorContains(t, err, "error decompressing")
+}
+
+func TestNewReaderShortInput(t *testing.T) {
+	t.Parallel()
+	reader, err := NewReader(bytes.NewReader([]byte("a\n")), "")
+	assert.NoError(t, err)
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", string(content))
+}
+
+func TestTrimExtension(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "queries.csv", TrimExtension("queries.csv.gz"))
+	assert.Equal(t, "queries.ndjson", TrimExtension("queries.ndjson.ZST"))
+	assert.Equal(t, "queries.csv", TrimExtension("queries.csv"))
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "csv", Format("queries.csv.gz"))
+	assert.Equal(t, "ndjson", Format("queries.ndjson.zst"))
+	assert.Equal(t, "ndjson", Format("queries.jsonl"))
+	assert.Equal(t, "csv", Format(""))
+}
+
+func TestExpand(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for _, name := range []string{"b.csv", "a.csv.gz", "c.ndjson", ".hidden"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "nested"), 0o700))
+
+	paths, err := Expand([]string{dir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.csv.gz"),
+		filepath.Join(dir, "b.csv"),
+		filepath.Join(dir, "c.ndjson"),
+	}, paths)
+
+	paths, err = Expand([]string{filepath.Join(dir, "c.ndjson"), filepath.Join(dir, "*.csv*")})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "c.ndjson"),
+		filepath.Join(dir, "a.csv.gz"),
+		filepath.Join(dir, "b.csv"),
+	}, paths)
+
+	_, err = Expand([]string{filepath.Join(dir, "*.parquet")})
+	assert.ErrorContains(t, err, "no input files match")
+
+	_, err = Expand([]string{filepath.Join(dir, "nested")})
+	assert.ErrorContains(t, err, "no input files in directory")
+
+	_, err = Expand([]string{filepath.Join(dir, "missing.csv")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// BreakdownDefaultSampleSize is the number of samples kept per group, smaller than the overall metrics
+	// since a breakdown keeps one reservoir per group
+	BreakdownDefaultSampleSize = 1_000
+	// HostDefaultSampleSize is the number of samples kept per hostname, inputs have thousands of hostnames
+	HostDefaultSampleSize = 100
+	// HostDefaultMaxGroups is the number of hostnames tracked, each one takes up to about 1 KB
+	HostDefaultMaxGroups = 10_000
+)
+
+// Breakdown keeps the metrics of each group of queries, e.g. one group per query type
+// Each group is a Reservoir so memory is bounded per group, its samples grow with the queries of the group
+// With maxGroups, queries of groups after the first maxGroups are only counted, see Untracked
+type Breakdown struct {
+	groups       map[string]*Reservoir
+	sampleSize   int
+	maxGroups    int
+	untracked    int
+	funcRandIntn func(n int) int
+}
+
+// NewBreakdown creates a new Breakdown with the default sample size per group
+func NewBreakdown(funcRandIntn func(n int) int) *Breakdown {
+	return &Breakdown{
+		groups:       make(map[string]*Reservoir),
+		sampleSize:   BreakdownDefaultSampleSize,
+		funcRandIntn: funcRandIntn,
+	}
+}
+
+// NewBreakdownWithSize creates a new Breakdown with the given sample size per group
+func NewBreakdownWithSize(sampleSize int, funcRandIntn func(n int) int) (*Breakdown, error) {
+	if sampleSize < 1 {
+		return nil, fmt.Errorf("sampleSize must be greater than 0")
+	}
+
+	if sampleSize > ReservoirMaxCapacity {
+		return nil, fmt.Errorf("sampleSize must be less than %d", ReservoirMaxCapacity)
+	}
+
+	return &Breakdown{
+		groups:       make(map[string]*Reservoir),
+		sampleSize:   sampleSize,
+		funcRandIntn: funcRandIntn,
+	}, nil
+}
+
+// NewBreakdownWithLimit creates a new Breakdown with the given sample size per group that tracks up to maxGroups groups
+func NewBreakdownWithLimit(sampleSize int, maxGroups int, funcRandIntn func(n int) int) (*Breakdown, error) {
+	if maxGroups < 1 {
+		return nil, fmt.Errorf("maxGroups must be greater than 0")
+	}
+
+	breakdown, err := NewBreakdownWithSize(sampleSize, funcRandIntn)
+	if err != nil {
+		return nil, err
+	}
+	breakdown.maxGroups = maxGroups
+	return breakdown, nil
+}
+
+// group returns the reservoir of the group, nil when the group is new and maxGroups are already tracked
+// Samples are allocated as responses are added, groups with a few queries stay small
+func (b *Breakdown) group(name string) *Reservoir {
+	reservoir, exists := b.groups[name]
+	if !exists {
+		if b.maxGroups > 0 && len(b.groups) >= b.maxGroups {
+			return nil
+		}
+		reservoir = &Reservoir{
+			sampleSize:   b.sampleSize,
+			funcRandIntn: b.funcRandIntn,
+		}
+		b.groups[name] = reservoir
+	}
+	return reservoir
+}
+
+// AddResponse adds a response duration to the group
+func (b *Breakdown) AddResponse(name string, duration time.Duration) {
+	if reservoir := b.group(name); reservoir != nil {
+		reservoir.AddResponse(duration)
+		return
+	}
+	b.untracked++
+}
+
+// AddFailed counts a failed query of the group
+func (b *Breakdown) AddFailed(name string) {
+	if reservoir := b.group(name); reservoir != nil {
+		reservoir.AddFailed()
+		return
+	}
+	b.untracked++
+}
+
+// Untracked returns the number of queries of the groups over maxGroups, they are not in Aggregate
+func (b *Breakdown) Untracked() int {
+	return b.untracked
+}
+
+// Aggregate aggregates every group into a Result, nil when there are no groups
+func (b *Breakdown) Aggregate() map[string]Result {
+	if len(b.groups) == 0 {
+		return nil
+	}
+
+	results := make(map[string]Result, len(b.groups))
+	for name, reservoir := range b.groups {
+		results[name] = reservoir.Aggregate()
+	}
+	return results
+}
+
+// writeGroups writes one line per group sorted by name
+func writeGroups(builder *strings.Builder, title string, groups map[string]Result) {
+	builder.WriteString(fmt.Sprintf("\n%s\n", title))
+	builder.WriteString("---------------------\n")
+	for _, name := range slices.Sorted(maps.Keys(groups)) {
+		group := groups[name]
+		builder.WriteString(fmt.Sprintf("%s: queries %d, failed %d, min %v, median %v, average %v, max %v\n",
+			name, group.NumberOfQueries, group.FailedQueries, group.MinResponse, group.MedianResponse, group.AverageResponse, group.MaxResponse))
+	}
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+func TestBreakdownAggregate(t *testing.T) {
+	t.Parallel()
+	breakdown := NewBreakdown(func(_ int) int {
+		panic("this function should never be called in this test")
+	})
+	assert.Nil(t, breakdown.Aggregate())
+
+	breakdown.AddResponse("single-host", 1*time.Second)
+	breakdown.AddResponse("single-host", 3*time.Second)
+	breakdown.AddResponse("lastpoint", 2*time.Second)
+	breakdown.AddFailed("lastpoint")
+	// a group with only failures must not divide by zero
+	breakdown.AddFailed("high-cpu")
+
+	results := breakdown.Aggregate()
+	assert.Len(t, results, 3)
+	assert.Equal(t, 2, results["single-host"].NumberOfQueries)
+	assert.Equal(t, 2*time.Second, results["single-host"].AverageResponse)
+	assert.Equal(t, 1, results["lastpoint"].NumberOfQueries)
+	assert.Equal(t, 1, results["lastpoint"].FailedQueries)
+	assert.Equal(t, 0, results["high-cpu"].NumberOfQueries)
+	assert.Equal(t, 1, results["high-cpu"].FailedQueries)
+
+	result := Result{NumberOfQueries: 3, ByQueryType: results}
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+// Every response lands in exactly one group, so the groups add up to the totals
+func TestBreakdownAddsUpToTotalsProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		breakdown := NewBreakdown(func(n int) int {
+			return n - 1
+		})
+		reservoir := NewReservoir(func(n int) int {
+			return n - 1
+		})
+
+		groups := rapid.SliceOfN(rapid.SampledFrom([]string{"a", "b", "c"}), 1, 5_000).Draw(t, "groups")
+		for _, group := range groups {
+			duration := time.Duration(rapid.IntRange(1, 1_000).Draw(t, "duration")) * time.Millisecond
+			breakdown.AddResponse(group, duration)
+			reservoir.AddResponse(duration)
+		}
+
+		total := reservoir.Aggregate()
+		numberOfQueries := 0
+		totalProcessingTime := time.Duration(0)
+		for _, result := range breakdown.Aggregate() {
+			numberOfQueries += result.NumberOfQueries
+			totalProcessingTime += result.TotalProcessingTime
+			assert.GreaterOrEqual(t, result.MinResponse, total.MinResponse)
+			assert.LessOrEqual(t, result.MaxResponse, total.MaxResponse)
+		}
+		assert.Equal(t, total.NumberOfQueries, numberOfQueries)
+		assert.Equal(t, total.TotalProcessingTime, totalProcessingTime)
+	})
+}
+
+func TestNewBreakdownWithSizeInvalidSize(t *testing.T) {
+	t.Parallel()
+	for _, sampleSize := range []int{0, ReservoirMaxCapacity + 1} {
+		breakdown, err := NewBreakdownWithSize(sampleSize, func(_ int) int {
+			return 0
+		})
+		assert.Error(t, err)
+		assert.Nil(t, breakdown)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestBreakdownWithLimitCountsUntracked(t *testing.T) {
+	t.Parallel()
+	breakdown, err := NewBreakdownWithLimit(10, 2, func(_ int) int {
+		panic("this function should never be called in this test")
+	})
+	assert.NoError(t, err)
+
+	breakdown.AddResponse("a", time.Millisecond)
+	breakdown.AddResponse("b", time.Millisecond)
+	breakdown.AddResponse("c", time.Millisecond)
+	breakdown.AddFailed("c")
+	breakdown.AddResponse("a", time.Millisecond)
+
+	results := breakdown.Aggregate()
+	assert.Len(t, results, 2)
+	assert.Equal(t, 2, results["a"].NumberOfQueries)
+	assert.Equal(t, 2, breakdown.Untracked())
+
+	_, err = NewBreakdownWithLimit(10, 0, func(_ int) int { return 0 })
+	assert.EqualError(t, err, "maxGroups must be greater than 0")
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// DefaultTopHosts is the number of slowest hosts printed by Table
+const DefaultTopHosts = 10
+
+// SlowestHosts returns up to n hostnames of ByHost from the slowest, by p99 then median response
+// Hosts with the same latencies are sorted by name so reports are stable
+func (r *Result) SlowestHosts(n int) []string {
+	hosts := slices.SortedFunc(maps.Keys(r.ByHost), func(a, b string) int {
+		hostA, hostB := r.ByHost[a], r.ByHost[b]
+		return cmp.Or(
+			cmp.Compare(hostB.P99Response, hostA.P99Response),
+			cmp.Compare(hostB.MedianResponse, hostA.MedianResponse),
+			cmp.Compare(a, b),
+		)
+	})
+	return hosts[:min(n, len(hosts))]
+}
+
+// writeHosts writes one line per slowest host with its percentiles, to compare with the totals above
+func writeHosts(builder *strings.Builder, r *Result) {
+	hosts := r.SlowestHosts(DefaultTopHosts)
+	builder.WriteString(fmt.Sprintf("\nSlowest Hosts (top %d of %d)\n", len(hosts), len(r.ByHost)))
+	builder.WriteString("---------------------\n")
+	for _, name := range hosts {
+		host := r.ByHost[name]
+		builder.WriteString(fmt.Sprintf("%s: queries %d, failed %d, median %v, p90 %v, p95 %v, p99 %v, max %v\n",
+			name, host.NumberOfQueries, host.FailedQueries, host.MedianResponse, host.P90Response, host.P95Response, host.P99Response, host.MaxResponse))
+	}
+	if r.UntrackedHostQueries > 0 {
+		builder.WriteString(fmt.Sprintf("Untracked Hosts: %d queries of the hosts after the first %d\n", r.UntrackedHostQueries, len(r.ByHost)))
+	}
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowestHosts(t *testing.T) {
+	t.Parallel()
+	result := Result{ByHost: map[string]Result{
+		"host_1": {MedianResponse: 10 * time.Millisecond, P99Response: 20 * time.Millisecond},
+		"host_2": {MedianResponse: 10 * time.Millisecond, P99Response: 90 * time.Millisecond},
+		"host_3": {MedianResponse: 30 * time.Millisecond, P99Response: 20 * time.Millisecond},
+		"host_4": {MedianResponse: 10 * time.Millisecond, P99Response: 20 * time.Millisecond},
+	}}
+	assert.Equal(t, []string{"host_2", "host_3", "host_1", "host_4"}, result.SlowestHosts(10))
+	assert.Equal(t, []string{"host_2", "host_3"}, result.SlowestHosts(2))
+	assert.Empty(t, (&Result{}).SlowestHosts(DefaultTopHosts))
+}
+
+func TestTableSlowestHostsSnapshot(t *testing.T) {
+	t.Parallel()
+	breakdown, err := NewBreakdownWithSize(HostDefaultSampleSize, func(_ int) int {
+		panic("this function should never be called in this test")
+	})
+	assert.NoError(t, err)
+
+	// host_i answers in i ms, host_7 also has a slow tail and a failure
+	for i := range 12 {
+		for range 10 {
+			breakdown.AddResponse(fmt.Sprintf("host_%d", i), time.Duration(i)*time.Millisecond)
+		}
+	}
+	breakdown.AddResponse("host_7", time.Second)
+	breakdown.AddFailed("host_7")
+
+	result := Result{NumberOfQueries: 121, FailedQueries: 1, ByHost: breakdown.Aggregate()}
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+func TestTableUntrackedHostsSnapshot(t *testing.T) {
+	t.Parallel()
+	result := Result{NumberOfQueries: 5, UntrackedHostQueries: 3, ByHost: map[string]Result{
+		"host_1": {NumberOfQueries: 1, MedianResponse: time.Millisecond},
+		"host_2": {NumberOfQueries: 1, MedianResponse: 2 * time.Millisecond},
+	}}
+	snaps.MatchSnapshot(t, result.Table())
+}
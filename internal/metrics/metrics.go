@@ -2,26 +2,82 @@ package metrics
 
 import (
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"strings"
 	"time"
 )
 
+// Status is how a run ended
+type Status string
+
+const (
+	// StatusCompleted runs read the whole input
+	StatusCompleted Status = "completed"
+	// StatusInterrupted runs were stopped by a timeout or a signal before the end of the input
+	StatusInterrupted Status = "interrupted"
+	// StatusAborted runs were stopped by the worker pool, e.g. by the error policy or the circuit breaker
+	StatusAborted Status = "aborted"
+)
+
 // Result is the aggregated metrics for the Simple metrics
 // - # of queries processed,
+// - # of skipped queries, by reason when known,
 // - total processing time across all queries,
 // - the minimum query time (for a single query),
 // - the median query time,
+// - the 90th, 95th and 99th percentile query times,
 // - the average query time,
 // - and the maximum query time.
 type Result struct {
+	// Status is how the run ended, empty for results not produced by a run
+	Status              Status
 	NumberOfQueries     int
 	SkippedQueries      int
+	SkippedReasons      map[string]int
 	FailedQueries       int
 	TotalProcessingTime time.Duration
 	MinResponse         time.Duration
 	MedianResponse      time.Duration
+	P90Response         time.Duration
+	P95Response         time.Duration
+	P99Response         time.Duration
 	AverageResponse     time.Duration
 	MaxResponse         time.Duration
+
+	// AbortReason is the error that aborted the run, e.g. aborted: database unhealthy, printed as the status
+	// Only set for aborted runs
+	AbortReason string
+
+	// NotDispatched is the number of queries read from the input and never sent to the database, only set when interrupted
+	// or aborted by the circuit breaker
+	NotDispatched int
+	// Cancelled is the number of queries sent to the database and cancelled before they answered, at the end of the grace
+	// period of an interrupted run or when the circuit breaker aborts it. They are not failed queries
+	Cancelled int
+	// WarmupQueries is the number of queries run before measuring, they are kept out of every other metric
+	WarmupQueries int
+
+	// Corrected is the latency measured from the intended start of each query instead of the actual send,
+	// only set for runs at a target rate. It includes the time queries waited for a free worker
+	Corrected *Result
+
+	// Queue is the depth of the worker queues, only set by the worker pool
+	Queue *QueueResult
+	// Throttle is how often queries waited for the rate limits, only set for rate limited runs
+	Throttle *ThrottleResult
+	// Workers is the load of each worker, only set by the worker pool, see WorkersTable
+	Workers []WorkerResult
+
+	// ByQueryType is the breakdown of the successful and failed queries per query type
+	ByQueryType map[string]Result
+	// ByTag is the breakdown per tag, keyed by name=value. Queries with several tags are in every group
+	ByTag map[string]Result
+	// ByHost is the breakdown per hostname, only the slowest hosts are printed, see SlowestHosts
+	ByHost map[string]Result
+	// UntrackedHostQueries is the number of queries of the hostnames after the first ones tracked in ByHost
+	UntrackedHostQueries int
 }
 
 func (r *Result) Table() string {
@@ -29,13 +85,77 @@ func (r *Result) Table() string {
 	builder.WriteString("\n\n=====================\n")
 	builder.WriteString("Performance Metrics\n")
 	builder.WriteString("=====================\n")
+	// completed runs are the norm, only the partial results of other runs are marked
+	switch {
+	case r.AbortReason != "":
+		builder.WriteString(fmt.Sprintf("Status: %s\n", r.AbortReason))
+	case r.Status != "" && r.Status != StatusCompleted:
+		builder.WriteString(fmt.Sprintf("Status: %s\n", r.Status))
+	}
 	builder.WriteString(fmt.Sprintf("Queries Processed: %d\n", r.NumberOfQueries))
 	builder.WriteString(fmt.Sprintf("Skipped Queries: %d\n", r.SkippedQueries))
+	for _, reason := range slices.Sorted(maps.Keys(r.SkippedReasons)) {
+		builder.WriteString(fmt.Sprintf("  - %s: %d\n", reason, r.SkippedReasons[reason]))
+	}
 	builder.WriteString(fmt.Sprintf("Failed Queries: %d\n", r.FailedQueries))
+	if r.Status == StatusInterrupted || r.NotDispatched > 0 {
+		builder.WriteString(fmt.Sprintf("Not Dispatched Queries: %d\n", r.NotDispatched))
+	}
+	if r.Cancelled > 0 {
+		builder.WriteString(fmt.Sprintf("Cancelled Queries: %d\n", r.Cancelled))
+	}
+	if r.WarmupQueries > 0 {
+		builder.WriteString(fmt.Sprintf("Warmup Queries (excluded): %d\n", r.WarmupQueries))
+	}
 	builder.WriteString(fmt.Sprintf("Total Time: %v\n", r.TotalProcessingTime))
 	builder.WriteString(fmt.Sprintf("Min Response: %v\n", r.MinResponse))
 	builder.WriteString(fmt.Sprintf("Median Response: %v\n", r.MedianResponse))
+	builder.WriteString(fmt.Sprintf("P90 Response: %v\n", r.P90Response))
+	builder.WriteString(fmt.Sprintf("P95 Response: %v\n", r.P95Response))
+	builder.WriteString(fmt.Sprintf("P99 Response: %v\n", r.P99Response))
 	builder.WriteString(fmt.Sprintf("Average Response: %v\n", r.AverageResponse))
 	builder.WriteString(fmt.Sprintf("Max Response: %v\n", r.MaxResponse))
+	if r.Corrected != nil {
+		writeCorrected(&builder, r.Corrected)
+	}
+	if r.Queue != nil {
+		writeQueue(&builder, r.Queue)
+	}
+	if r.Throttle != nil {
+		writeThrottle(&builder, r.Throttle)
+	}
+	// a single group is the same as the totals
+	if len(r.ByQueryType) > 1 {
+		writeGroups(&builder, "Query Types", r.ByQueryType)
+	}
+	if len(r.ByTag) > 0 {
+		writeGroups(&builder, "Tags", r.ByTag)
+	}
+	// a single host is the same as the totals
+	if len(r.ByHost) > 1 {
+		writeHosts(&builder, r)
+	}
 	return builder.String()
 }
+
+// writeCorrected writes the latency from the intended start next to the response times above
+func writeCorrected(builder *strings.Builder, corrected *Result) {
+	builder.WriteString("\nCorrected Latency (from intended start)\n")
+	builder.WriteString("---------------------\n")
+	builder.WriteString(fmt.Sprintf("Min: %v\n", corrected.MinResponse))
+	builder.WriteString(fmt.Sprintf("Median: %v\n", corrected.MedianResponse))
+	builder.WriteString(fmt.Sprintf("P90: %v\n", corrected.P90Response))
+	builder.WriteString(fmt.Sprintf("P95: %v\n", corrected.P95Response))
+	builder.WriteString(fmt.Sprintf("P99: %v\n", corrected.P99Response))
+	builder.WriteString(fmt.Sprintf("Average: %v\n", corrected.AverageResponse))
+	builder.WriteString(fmt.Sprintf("Max: %v\n", corrected.MaxResponse))
+}
+
+// percentile returns the nearest rank percentile p in (0, 1] of the sorted responses, 0 when there are none
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gkampitakis/go-snaps/snaps"
 	"github.com/stretchr/testify/assert"
 	"pgregory.net/rapid"
 )
@@ -77,3 +78,83 @@ func TestCompareSimpleAndReservoirWhenSampleSizeIsGreaterThanReservoirSampleSize
 		// assert.Equal(t, simpleResult.MedianResponse, reservoirResult.MedianResponse)
 	})
 }
+
+func TestTableSkippedReasonsSnapshot(t *testing.T) {
+	t.Parallel()
+	simpleMetrics := NewSimple()
+	reservoirMetrics := NewReservoir(func(_ int) int {
+		panic("this function should never be called in this test")
+	})
+
+	for _, reason := range []string{"invalid_value", "start_after_end", "invalid_value"} {
+		simpleMetrics.AddSkippedWithReason(reason)
+		reservoirMetrics.AddSkippedWithReason(reason)
+	}
+	simpleMetrics.AddSkipped()
+	reservoirMetrics.AddSkipped()
+	simpleMetrics.AddResponse(1 * time.Second)
+	reservoirMetrics.AddResponse(1 * time.Second)
+
+	simpleResult := simpleMetrics.Aggregate()
+	assert.Equal(t, simpleResult, reservoirMetrics.Aggregate())
+	assert.Equal(t, 4, simpleResult.SkippedQueries)
+	assert.Equal(t, map[string]int{"invalid_value": 2, "start_after_end": 1}, simpleResult.SkippedReasons)
+	snaps.MatchSnapshot(t, simpleResult.Table())
+}
+
+func TestTableTagsSnapshot(t *testing.T) {
+	t.Parallel()
+	tags := NewBreakdown(func(_ int) int {
+		panic("this function should never be called in this test")
+	})
+	tags.AddResponse("dashboard=ops", 1*time.Second)
+	tags.AddResponse("dashboard=ops", 3*time.Second)
+	tags.AddResponse("tenant=A", 1*time.Second)
+	tags.AddFailed("tenant=B")
+
+	result := Result{NumberOfQueries: 2, FailedQueries: 1, ByTag: tags.Aggregate()}
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+func TestPercentile(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Duration(0), percentile(nil, 0.99))
+	assert.Equal(t, time.Second, percentile([]time.Duration{time.Second}, 0.01))
+
+	responses := make([]time.Duration, 1000)
+	for i := range responses {
+		responses[i] = time.Duration(i+1) * time.Millisecond
+	}
+	assert.Equal(t, 900*time.Millisecond, percentile(responses, 0.90))
+	assert.Equal(t, 950*time.Millisecond, percentile(responses, 0.95))
+	assert.Equal(t, 990*time.Millisecond, percentile(responses, 0.99))
+	assert.Equal(t, 1000*time.Millisecond, percentile(responses, 1))
+}
+
+func TestTableCorrectedSnapshot(t *testing.T) {
+	t.Parallel()
+	responses := NewSimple()
+	corrected := NewSimple()
+	for i := range 100 {
+		responses.AddResponse(10 * time.Millisecond)
+		// queries queued behind a stall wait longer and longer for a worker
+		corrected.AddResponse(10*time.Millisecond + time.Duration(i)*time.Millisecond)
+	}
+
+	result := responses.Aggregate()
+	correctedResult := corrected.Aggregate()
+	result.Corrected = &correctedResult
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+func TestTableAbortedSnapshot(t *testing.T) {
+	t.Parallel()
+	result := Result{
+		Status:          StatusAborted,
+		AbortReason:     "aborted: database unhealthy: 5 queries in a row failed",
+		NumberOfQueries: 10,
+		FailedQueries:   6,
+		NotDispatched:   32,
+	}
+	snaps.MatchSnapshot(t, result.Table())
+}
@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Queue keeps the depth of the worker queues seen by each dispatched query
+// and how long dispatching waited for a full queue, the backpressure on the reader
+type Queue struct {
+	queues     int
+	capacity   int
+	dispatched int
+	depths     int
+	maxDepth   int
+	waits      int
+	waitTime   time.Duration
+}
+
+// QueueResult is the aggregated metrics of the worker queues
+type QueueResult struct {
+	// Queues is the number of queues and Capacity the queries each one holds
+	Queues   int
+	Capacity int
+	// Dispatched is the number of queries queued
+	Dispatched int
+	// AverageDepth and MaxDepth are the queries already queued when a query was dispatched
+	AverageDepth float64
+	MaxDepth     int
+	// Waits is the number of queries dispatched to a full queue, WaitTime the time the reader waited for them
+	Waits    int
+	WaitTime time.Duration
+	// Stolen is the number of queries run by another worker than the one of their queue, only with WorkStealing
+	WorkStealing bool
+	Stolen       int
+}
+
+// StealingRate is the share of the dispatched queries that were stolen
+func (q *QueueResult) StealingRate() float64 {
+	if q.Dispatched == 0 {
+		return 0
+	}
+	return float64(q.Stolen) / float64(q.Dispatched)
+}
+
+// NewQueue creates a new Queue for queues of the given capacity
+func NewQueue(queues int, capacity int) *Queue {
+	return &Queue{queues: queues, capacity: capacity}
+}
+
+// AddDispatch adds a query dispatched to a queue holding depth queries, wait is the time it waited for room
+func (q *Queue) AddDispatch(depth int, wait time.Duration) {
+	q.dispatched++
+	q.depths += depth
+	q.maxDepth = max(q.maxDepth, depth)
+	if wait > 0 {
+		q.waits++
+		q.waitTime += wait
+	}
+}
+
+// Aggregate aggregates the dispatches into a QueueResult
+func (q *Queue) Aggregate() *QueueResult {
+	result := &QueueResult{
+		Queues:     q.queues,
+		Capacity:   q.capacity,
+		Dispatched: q.dispatched,
+		MaxDepth:   q.maxDepth,
+		Waits:      q.waits,
+		WaitTime:   q.waitTime,
+	}
+	if q.dispatched > 0 {
+		result.AverageDepth = float64(q.depths) / float64(q.dispatched)
+	}
+	return result
+}
+
+func writeQueue(builder *strings.Builder, queue *QueueResult) {
+	builder.WriteString("\nQueues\n")
+	builder.WriteString("---------------------\n")
+	builder.WriteString(fmt.Sprintf("Queues: %d, capacity %d each\n", queue.Queues, queue.Capacity))
+	builder.WriteString(fmt.Sprintf("Average Depth: %.2f\n", queue.AverageDepth))
+	builder.WriteString(fmt.Sprintf("Max Depth: %d\n", queue.MaxDepth))
+	builder.WriteString(fmt.Sprintf("Full Queue Waits: %d, %v\n", queue.Waits, queue.WaitTime))
+	if queue.WorkStealing {
+		builder.WriteString(fmt.Sprintf("Stolen Queries: %d of %d, %.1f%%\n", queue.Stolen, queue.Dispatched, queue.StealingRate()*100))
+	}
+}
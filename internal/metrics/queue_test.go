@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueAggregate(t *testing.T) {
+	t.Parallel()
+	queue := NewQueue(4, 2)
+	assert.Equal(t, &QueueResult{Queues: 4, Capacity: 2}, queue.Aggregate())
+
+	queue.AddDispatch(0, 0)
+	queue.AddDispatch(1, 0)
+	queue.AddDispatch(2, 10*time.Millisecond)
+	queue.AddDispatch(2, 30*time.Millisecond)
+
+	result := queue.Aggregate()
+	assert.Equal(t, 1.25, result.AverageDepth)
+	assert.Equal(t, 2, result.MaxDepth)
+	assert.Equal(t, 2, result.Waits)
+	assert.Equal(t, 40*time.Millisecond, result.WaitTime)
+
+	table := Result{NumberOfQueries: 4, Queue: result}
+	snaps.MatchSnapshot(t, table.Table())
+}
+
+func TestQueueStealingRate(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0.0, (&QueueResult{WorkStealing: true}).StealingRate())
+
+	queue := NewQueue(2, 4)
+	for range 8 {
+		queue.AddDispatch(0, 0)
+	}
+	result := queue.Aggregate()
+	result.WorkStealing, result.Stolen = true, 2
+	assert.Equal(t, 0.25, result.StealingRate())
+
+	table := Result{NumberOfQueries: 8, Queue: result}
+	snaps.MatchSnapshot(t, table.Table())
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"slices"
 	"time"
@@ -20,6 +21,7 @@ type Reservoir struct {
 	responses           []time.Duration
 	numberOfQueries     int
 	skippedQueries      int
+	skippedReasons      map[string]int
 	failedQueries       int
 	totalProcessingTime time.Duration
 	minResponse         time.Duration
@@ -61,6 +63,15 @@ func (r *Reservoir) AddSkipped() {
 	r.skippedQueries++
 }
 
+// AddSkippedWithReason counts a skipped query and the reason it was skipped
+func (r *Reservoir) AddSkippedWithReason(reason string) {
+	r.AddSkipped()
+	if r.skippedReasons == nil {
+		r.skippedReasons = make(map[string]int)
+	}
+	r.skippedReasons[reason]++
+}
+
 func (r *Reservoir) AddFailed() {
 	if r.failedQueries == math.MaxInt64 {
 		log.Panicf("failed queries overflow")
@@ -96,7 +107,11 @@ func (r *Reservoir) AddResponse(duration time.Duration) {
 // Aggregate aggregates the responses into a Result
 func (r *Reservoir) Aggregate() Result {
 	slices.Sort(r.responses)
-	averageResponse := r.totalProcessingTime / time.Duration(r.numberOfQueries)
+
+	var averageResponse time.Duration
+	if r.numberOfQueries > 0 {
+		averageResponse = r.totalProcessingTime / time.Duration(r.numberOfQueries)
+	}
 
 	var medianResponse time.Duration
 	if len(r.responses) > 0 {
@@ -107,10 +122,14 @@ func (r *Reservoir) Aggregate() Result {
 	return Result{
 		NumberOfQueries:     r.numberOfQueries,
 		SkippedQueries:      r.skippedQueries,
+		SkippedReasons:      maps.Clone(r.skippedReasons),
 		FailedQueries:       r.failedQueries,
 		TotalProcessingTime: r.totalProcessingTime,
 		MinResponse:         r.minResponse,
 		MedianResponse:      medianResponse,
+		P90Response:         percentile(r.responses, 0.90),
+		P95Response:         percentile(r.responses, 0.95),
+		P99Response:         percentile(r.responses, 0.99),
 		AverageResponse:     averageResponse,
 		MaxResponse:         r.maxResponse,
 	}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"log"
+	"maps"
 	"math"
 	"slices"
 	"time"
@@ -18,6 +19,7 @@ const (
 type Simple struct {
 	responses      []time.Duration
 	skippedQueries int
+	skippedReasons map[string]int
 	failedQueries  int
 	capacity       int
 }
@@ -64,6 +66,15 @@ func (s *Simple) AddSkipped() {
 	s.skippedQueries++
 }
 
+// AddSkippedWithReason counts a skipped query and the reason it was skipped
+func (s *Simple) AddSkippedWithReason(reason string) {
+	s.AddSkipped()
+	if s.skippedReasons == nil {
+		s.skippedReasons = make(map[string]int)
+	}
+	s.skippedReasons[reason]++
+}
+
 func (s *Simple) AddFailed() {
 	if s.skippedQueries == math.MaxInt64 {
 		log.Panicf("failed queries overflow")
@@ -76,6 +87,15 @@ func (s *Simple) Aggregate() Result {
 	slices.Sort(s.responses)
 
 	numberOfQueries := len(s.responses)
+	// runs aborted early or with every query skipped or failed have no responses
+	if numberOfQueries == 0 {
+		return Result{
+			SkippedQueries: s.skippedQueries,
+			SkippedReasons: maps.Clone(s.skippedReasons),
+			FailedQueries:  s.failedQueries,
+		}
+	}
+
 	minResponse := s.responses[0]
 	maxResponse := s.responses[0]
 	totalProcessingTime := time.Duration(0)
@@ -95,10 +115,14 @@ func (s *Simple) Aggregate() Result {
 	return Result{
 		NumberOfQueries:     numberOfQueries,
 		SkippedQueries:      s.skippedQueries,
+		SkippedReasons:      maps.Clone(s.skippedReasons),
 		FailedQueries:       s.failedQueries,
 		TotalProcessingTime: totalProcessingTime,
 		MinResponse:         minResponse,
 		MedianResponse:      medianResponse,
+		P90Response:         percentile(s.responses, 0.90),
+		P95Response:         percentile(s.responses, 0.95),
+		P99Response:         percentile(s.responses, 0.99),
 		AverageResponse:     averageResponse,
 		MaxResponse:         maxResponse,
 	}
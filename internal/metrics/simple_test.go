@@ -78,6 +78,9 @@ func TestSimpleMetricsAggregate(t *testing.T) {
 	assert.Equal(t, 55*time.Second, result.TotalProcessingTime)
 	assert.Equal(t, 1*time.Second, result.MinResponse)
 	assert.Equal(t, 6*time.Second, result.MedianResponse)
+	assert.Equal(t, 9*time.Second, result.P90Response)
+	assert.Equal(t, 10*time.Second, result.P95Response)
+	assert.Equal(t, 10*time.Second, result.P99Response)
 	assert.Equal(t, 55*time.Second/10, result.AverageResponse)
 	assert.Equal(t, 10*time.Second, result.MaxResponse)
 	snaps.MatchSnapshot(t, result)
@@ -96,3 +99,16 @@ func TestSimpleAddSkippedAndFailedToMaxThenOverflow(t *testing.T) {
 		metrics.AddFailed()
 	})
 }
+
+func TestSimpleAggregateWithoutResponses(t *testing.T) {
+	t.Parallel()
+	simple := NewSimple()
+	simple.AddSkippedWithReason("invalid_value")
+	simple.AddFailed()
+
+	result := simple.Aggregate()
+	assert.Equal(t, 0, result.NumberOfQueries)
+	assert.Equal(t, 1, result.SkippedQueries)
+	assert.Equal(t, 1, result.FailedQueries)
+	assert.Equal(t, map[string]int{"invalid_value": 1}, result.SkippedReasons)
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ThrottleResult is how often the rate limits of a run made queries wait
+type ThrottleResult struct {
+	// MaxRate is the cap of queries per second of the pool and MaxWorkerRate the cap of each worker, unlimited when 0
+	MaxRate       float64
+	MaxWorkerRate float64
+	// Queries is the number of queries that took a token, Throttled the ones that waited for it and WaitTime how long
+	Queries   int
+	Throttled int
+	WaitTime  time.Duration
+}
+
+// ThrottledRate is the share of the queries that waited for a token
+func (t *ThrottleResult) ThrottledRate() float64 {
+	if t.Queries == 0 {
+		return 0
+	}
+	return float64(t.Throttled) / float64(t.Queries)
+}
+
+func writeThrottle(builder *strings.Builder, throttle *ThrottleResult) {
+	builder.WriteString("\nRate Limit\n")
+	builder.WriteString("---------------------\n")
+	builder.WriteString(fmt.Sprintf("Max Rate: %s\n", formatRate(throttle.MaxRate)))
+	builder.WriteString(fmt.Sprintf("Max Worker Rate: %s\n", formatRate(throttle.MaxWorkerRate)))
+	builder.WriteString(fmt.Sprintf("Throttled Queries: %d of %d, %.1f%%, %v\n",
+		throttle.Throttled, throttle.Queries, throttle.ThrottledRate()*100, throttle.WaitTime.Round(time.Millisecond)))
+}
+
+func formatRate(rate float64) string {
+	if rate == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%.1f qps", rate)
+}
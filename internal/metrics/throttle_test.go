@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottledRate(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0.0, (&ThrottleResult{}).ThrottledRate())
+	assert.Equal(t, 0.25, (&ThrottleResult{Queries: 8, Throttled: 2}).ThrottledRate())
+}
+
+func TestTableThrottleSnapshot(t *testing.T) {
+	t.Parallel()
+	result := Result{
+		NumberOfQueries: 200,
+		Throttle:        &ThrottleResult{MaxRate: 100, Queries: 200, Throttled: 150, WaitTime: 1500 * time.Millisecond},
+	}
+	snaps.MatchSnapshot(t, result.Table())
+}
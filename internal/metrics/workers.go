@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// WorkerResult is the load of a single worker of the pool
+type WorkerResult struct {
+	Worker int
+	// Hostnames is the number of distinct hostnames the worker ran queries for
+	Hostnames int
+	// Stolen is the number of queries the worker took from the queue of another worker, see QueueResult.Stolen
+	Stolen int
+	// Throttled is the number of queries of the worker that waited for a rate limit, see ThrottleResult
+	Throttled int
+	// Busy is the time spent running queries, Idle the rest of the time the worker was up
+	Busy time.Duration
+	Idle time.Duration
+	// QueueWait is the total time the queries of the worker waited in its queue
+	QueueWait time.Duration
+	// Latency are the queries run by the worker and their response times
+	Latency Result
+}
+
+// Utilization is the share of the time the worker was busy
+func (w WorkerResult) Utilization() float64 {
+	if w.Busy+w.Idle <= 0 {
+		return 0
+	}
+	return float64(w.Busy) / float64(w.Busy+w.Idle)
+}
+
+// Skew summarizes how evenly a load is spread, e.g. the queries of each worker
+type Skew struct {
+	// MaxMeanRatio is the largest load over the mean load, 1 is perfectly even
+	MaxMeanRatio float64
+	// Gini is the Gini coefficient of the loads, 0 is perfectly even and 1 is all the load on one
+	Gini float64
+}
+
+// NewSkew computes the Skew of the loads, the zero Skew when there is no load
+func NewSkew(loads []float64) Skew {
+	sorted := slices.Clone(loads)
+	slices.Sort(sorted)
+
+	total, weighted := 0.0, 0.0
+	for i, load := range sorted {
+		total += load
+		weighted += float64(i+1) * load
+	}
+	if total == 0 {
+		return Skew{}
+	}
+
+	n := float64(len(sorted))
+	return Skew{
+		MaxMeanRatio: sorted[len(sorted)-1] / (total / n),
+		Gini:         2*weighted/(n*total) - (n+1)/n,
+	}
+}
+
+// WorkersTable prints a line per worker followed by the skew of the queries and busy time of the workers
+func (r *Result) WorkersTable() string {
+	builder := strings.Builder{}
+	builder.WriteString("\n\n=====================\n")
+	builder.WriteString("Workers\n")
+	builder.WriteString("=====================\n")
+
+	queries := make([]float64, len(r.Workers))
+	busy := make([]float64, len(r.Workers))
+	for i, worker := range r.Workers {
+		queries[i] = float64(worker.Latency.NumberOfQueries + worker.Latency.FailedQueries)
+		busy[i] = float64(worker.Busy)
+		builder.WriteString(fmt.Sprintf("worker %d: queries %d, failed %d, hostnames %d, stolen %d, throttled %d, busy %v, idle %v, utilization %.1f%%, queue wait %v, median %v, p99 %v, max %v\n",
+			worker.Worker, worker.Latency.NumberOfQueries, worker.Latency.FailedQueries, worker.Hostnames, worker.Stolen, worker.Throttled,
+			worker.Busy.Round(time.Millisecond), worker.Idle.Round(time.Millisecond), worker.Utilization()*100, worker.QueueWait.Round(time.Millisecond),
+			worker.Latency.MedianResponse, worker.Latency.P99Response, worker.Latency.MaxResponse))
+	}
+
+	querySkew, busySkew := NewSkew(queries), NewSkew(busy)
+	builder.WriteString("\nSkew\n")
+	builder.WriteString("---------------------\n")
+	builder.WriteString(fmt.Sprintf("Queries: max/mean %.2f, gini %.3f\n", querySkew.MaxMeanRatio, querySkew.Gini))
+	builder.WriteString(fmt.Sprintf("Busy Time: max/mean %.2f, gini %.3f\n", busySkew.MaxMeanRatio, busySkew.Gini))
+	return builder.String()
+}
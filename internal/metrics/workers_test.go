@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSkew(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, Skew{}, NewSkew(nil))
+	assert.Equal(t, Skew{}, NewSkew([]float64{0, 0}))
+	assert.Equal(t, Skew{MaxMeanRatio: 1, Gini: 0}, NewSkew([]float64{5, 5, 5, 5}))
+
+	// all the load on one of four workers
+	skew := NewSkew([]float64{0, 8, 0, 0})
+	assert.Equal(t, 4.0, skew.MaxMeanRatio)
+	assert.InDelta(t, 0.75, skew.Gini, 1e-9)
+
+	skew = NewSkew([]float64{1, 2, 3})
+	assert.InDelta(t, 1.5, skew.MaxMeanRatio, 1e-9)
+	assert.InDelta(t, 2.0/9, skew.Gini, 1e-9)
+}
+
+func TestWorkerResultUtilization(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0.0, WorkerResult{}.Utilization())
+	assert.Equal(t, 0.75, WorkerResult{Busy: 3 * time.Second, Idle: time.Second}.Utilization())
+}
+
+func TestWorkersTableSnapshot(t *testing.T) {
+	t.Parallel()
+	result := Result{Workers: []WorkerResult{
+		{
+			Worker: 0, Hostnames: 3, Busy: 3 * time.Second, Idle: time.Second, QueueWait: 200 * time.Millisecond,
+			Latency: Result{NumberOfQueries: 30, FailedQueries: 1, MedianResponse: 90 * time.Millisecond, P99Response: 150 * time.Millisecond, MaxResponse: 200 * time.Millisecond},
+		},
+		{
+			Worker: 1, Hostnames: 1, Stolen: 4, Busy: time.Second, Idle: 3 * time.Second,
+			Latency: Result{NumberOfQueries: 10, MedianResponse: 100 * time.Millisecond, P99Response: 120 * time.Millisecond, MaxResponse: 120 * time.Millisecond},
+		},
+	}}
+	snaps.MatchSnapshot(t, result.WorkersTable())
+}
@@ -0,0 +1,258 @@
+package query
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"path"
+	"time"
+)
+
+// FilterReader is a query Reader that only returns the queries kept by a predicate
+// Errors are passed through, so skipped rows are still counted
+type FilterReader struct {
+	reader Reader
+	keep   func(Query) bool
+}
+
+// NewFilterReader creates a new FilterReader
+func NewFilterReader(reader Reader, keep func(Query) bool) *FilterReader {
+	return &FilterReader{reader: reader, keep: keep}
+}
+
+// HostnameGlob keeps the queries whose hostname matches a shell pattern, e.g. host_00001*
+func HostnameGlob(pattern string) (func(Query) bool, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid hostname pattern %q: %w", pattern, err)
+	}
+
+	return func(query Query) bool {
+		matched, _ := path.Match(pattern, query.Hostname)
+		return matched
+	}, nil
+}
+
+// Next reads queries until one is kept
+func (r *FilterReader) Next() (Query, bool, error) {
+	for {
+		query, hasMore, err := r.reader.Next()
+		if err != nil || !hasMore || r.keep(query) {
+			return query, hasMore, err
+		}
+	}
+}
+
+// SampleReader is a query Reader that keeps each query with a fixed probability
+// Errors are passed through, so skipped rows are still counted
+type SampleReader struct {
+	reader   Reader
+	fraction float64
+	random   *rand.Rand
+}
+
+// NewSampleReader creates a new SampleReader keeping fraction of the queries, the seed makes the sample reproducible
+func NewSampleReader(reader Reader, fraction float64, seed int64) (*SampleReader, error) {
+	if fraction <= 0 || fraction > 1 {
+		return nil, fmt.Errorf("sample fraction %v must be in (0, 1]", fraction)
+	}
+
+	return &SampleReader{
+		reader:   reader,
+		fraction: fraction,
+		random:   rand.New(rand.NewSource(seed)), //nolint:gosec
+	}, nil
+}
+
+// Next reads queries until one is sampled
+func (r *SampleReader) Next() (Query, bool, error) {
+	for {
+		query, hasMore, err := r.reader.Next()
+		if err != nil || !hasMore || r.random.Float64() < r.fraction {
+			return query, hasMore, err
+		}
+	}
+}
+
+// LimitReader is a query Reader that stops after a number of queries, errors do not count towards the limit
+type LimitReader struct {
+	reader Reader
+	limit  int
+	read   int
+}
+
+// NewLimitReader creates a new LimitReader
+func NewLimitReader(reader Reader, limit int) (*LimitReader, error) {
+	if limit < 1 {
+		return nil, fmt.Errorf("limit must be greater than 0")
+	}
+
+	return &LimitReader{reader: reader, limit: limit}, nil
+}
+
+// Next reads the next query until the limit is reached
+func (r *LimitReader) Next() (Query, bool, error) {
+	if r.read >= r.limit {
+		return Query{}, false, nil
+	}
+
+	query, hasMore, err := r.reader.Next()
+	if err == nil && hasMore {
+		r.read++
+	}
+	return query, hasMore, err
+}
+
+// ShuffleReader is a query Reader that shuffles queries through a buffer of bufferSize queries
+// Each query is swapped with a random buffered one, a buffer as large as the input is a full shuffle
+// Memory is bounded by the buffer, errors are passed through as soon as they are read,
+// but an error ending the input is returned after the last buffered query
+type ShuffleReader struct {
+	reader     Reader
+	buffer     []Query
+	bufferSize int
+	random     *rand.Rand
+	done       bool
+	// err ended the input, it is returned once the buffer is drained
+	err error
+}
+
+// NewShuffleReader creates a new ShuffleReader, the seed makes the order reproducible
+func NewShuffleReader(reader Reader, bufferSize int, seed int64) (*ShuffleReader, error) {
+	if bufferSize < 1 {
+		return nil, fmt.Errorf("shuffle buffer size must be greater than 0")
+	}
+
+	return &ShuffleReader{
+		reader:     reader,
+		buffer:     make([]Query, 0, bufferSize),
+		bufferSize: bufferSize,
+		random:     rand.New(rand.NewSource(seed)), //nolint:gosec
+	}, nil
+}
+
+// Next fills the buffer and returns a random buffered query, then drains the buffer once the reader is done
+func (r *ShuffleReader) Next() (Query, bool, error) {
+	for !r.done && len(r.buffer) < r.bufferSize {
+		query, hasMore, err := r.reader.Next()
+		if !hasMore {
+			r.done = true
+			r.err = err
+			break
+		}
+		if err != nil {
+			return Query{}, true, err
+		}
+		r.buffer = append(r.buffer, query)
+	}
+
+	if len(r.buffer) == 0 {
+		err := r.err
+		r.err = nil
+		return Query{}, false, err
+	}
+
+	i := r.random.Intn(len(r.buffer))
+	query := r.buffer[i]
+	last := len(r.buffer) - 1
+	r.buffer[i] = r.buffer[last]
+	r.buffer = r.buffer[:last]
+	return query, true, nil
+}
+
+// LoopOpener opens a new pass of the input, the Closer may be nil
+type LoopOpener func() (Reader, io.Closer, error)
+
+// LoopReader is a query Reader that reads its input again and again
+// It stops after times passes or once duration has passed, whichever comes first. Zero disables each limit
+// A pass without any query ends the loop, so an empty input does not loop forever
+type LoopReader struct {
+	open     LoopOpener
+	times    int
+	duration time.Duration
+	now      func() time.Time
+
+	start   time.Time
+	passes  int
+	read    int
+	current Reader
+	closer  io.Closer
+}
+
+// NewLoopReader creates a new LoopReader, the first pass is opened right away so its errors are returned here
+func NewLoopReader(open LoopOpener, times int, duration time.Duration) (*LoopReader, error) {
+	if times < 0 || duration < 0 {
+		return nil, fmt.Errorf("loop times %d and duration %v must be greater or equal than 0", times, duration)
+	}
+
+	reader := &LoopReader{open: open, times: times, duration: duration, now: time.Now}
+	if err := reader.openPass(); err != nil {
+		return nil, err
+	}
+	reader.start = reader.now()
+
+	return reader, nil
+}
+
+// Next reads the next query of the current pass, opening a new pass when it ends
+func (r *LoopReader) Next() (Query, bool, error) {
+	for {
+		if r.duration > 0 && r.now().Sub(r.start) >= r.duration {
+			return Query{}, false, r.Close()
+		}
+
+		if r.current == nil {
+			if r.read == 0 || (r.times > 0 && r.passes >= r.times) {
+				return Query{}, false, nil
+			}
+			if err := r.openPass(); err != nil {
+				return Query{}, false, err
+			}
+		}
+
+		query, hasMore, err := r.current.Next()
+		if hasMore {
+			if err == nil {
+				r.read++
+			}
+			return query, true, err
+		}
+
+		closeErr := r.Close()
+		if err != nil {
+			return Query{}, r.read > 0 && (r.times == 0 || r.passes < r.times), err
+		}
+		if closeErr != nil {
+			return Query{}, false, closeErr
+		}
+	}
+}
+
+// Passes returns the number of passes started
+func (r *LoopReader) Passes() int {
+	return r.passes
+}
+
+// Close closes the current pass
+func (r *LoopReader) Close() error {
+	r.current = nil
+	if r.closer == nil {
+		return nil
+	}
+
+	closer := r.closer
+	r.closer = nil
+	return closer.Close()
+}
+
+func (r *LoopReader) openPass() error {
+	reader, closer, err := r.open()
+	if err != nil {
+		return fmt.Errorf("error opening loop pass %d: %w", r.passes+1, err)
+	}
+
+	r.passes++
+	r.read = 0
+	r.current = reader
+	r.closer = closer
+	return nil
+}
@@ -0,0 +1,291 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+// testSliceReader returns the queries of a slice, an empty hostname is returned as an error
+type testSliceReader struct {
+	queries []Query
+	next    int
+}
+
+func (r *testSliceReader) Next() (Query, bool, error) {
+	if r.next >= len(r.queries) {
+		return Query{}, false, nil
+	}
+	query := r.queries[r.next]
+	r.next++
+	if query.Hostname == "" {
+		return Query{}, true, &RowError{Line: r.next, Reason: ReasonMalformedRow, Err: errors.New("empty hostname")}
+	}
+	return query, true, nil
+}
+
+func testQueries(hostnames ...string) []Query {
+	queries := make([]Query, len(hostnames))
+	for i, hostname := range hostnames {
+		queries[i] = Query{Hostname: hostname}
+	}
+	return queries
+}
+
+// readHostnames reads every query and returns their hostnames and the number of errors
+func readHostnames(t assert.TestingT, reader Reader) ([]string, int) {
+	var hostnames []string
+	errs := 0
+	for {
+		query, hasMore, err := reader.Next()
+		if err != nil {
+			errs++
+		} else if hasMore {
+			hostnames = append(hostnames, query.Hostname)
+		}
+		if !hasMore {
+			return hostnames, errs
+		}
+		assert.Less(t, len(hostnames)+errs, 1_000_000, "reader does not end")
+	}
+}
+
+func TestFilterReader(t *testing.T) {
+	t.Parallel()
+	keep, err := HostnameGlob("host_00001*")
+	assert.NoError(t, err)
+
+	reader := NewFilterReader(&testSliceReader{queries: testQueries("host_000010", "host_000002", "", "host_000019")}, keep)
+	hostnames, errs := readHostnames(t, reader)
+	assert.Equal(t, []string{"host_000010", "host_000019"}, hostnames)
+	assert.Equal(t, 1, errs)
+
+	_, err = HostnameGlob("host_[")
+	assert.Error(t, err)
+}
+
+func TestLimitReader(t *testing.T) {
+	t.Parallel()
+	reader, err := NewLimitReader(&testSliceReader{queries: testQueries("a", "", "b", "c")}, 2)
+	assert.NoError(t, err)
+
+	hostnames, errs := readHostnames(t, reader)
+	assert.Equal(t, []string{"a", "b"}, hostnames)
+	assert.Equal(t, 1, errs)
+
+	_, err = NewLimitReader(reader, 0)
+	assert.Error(t, err)
+}
+
+func TestSampleReaderProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		hostnames := rapid.SliceOf(rapid.StringMatching(`host_[0-9]{6}`)).Draw(t, "hostnames")
+		fraction := rapid.Float64Range(0.01, 1).Draw(t, "fraction")
+		seed := rapid.Int64().Draw(t, "seed")
+
+		read := func() []string {
+			reader, err := NewSampleReader(&testSliceReader{queries: testQueries(hostnames...)}, fraction, seed)
+			assert.NoError(t, err)
+			sampled, _ := readHostnames(t, reader)
+			return sampled
+		}
+
+		sampled := read()
+		assert.Equal(t, sampled, read())
+		// the sample keeps the input order
+		i := 0
+		for _, hostname := range sampled {
+			for hostnames[i] != hostname {
+				i++
+			}
+			i++
+		}
+	})
+
+	_, err := NewSampleReader(&testSliceReader{}, 0, 1)
+	assert.Error(t, err)
+}
+
+func TestSampleReaderFraction(t *testing.T) {
+	t.Parallel()
+	hostnames := make([]string, 10_000)
+	for i := range hostnames {
+		hostnames[i] = fmt.Sprintf("host_%06d", i)
+	}
+
+	reader, err := NewSampleReader(&testSliceReader{queries: testQueries(hostnames...)}, 0.1, 42)
+	assert.NoError(t, err)
+	sampled, _ := readHostnames(t, reader)
+	assert.InDelta(t, 1_000, len(sampled), 100)
+}
+
+func TestShuffleReaderProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		hostnames := rapid.SliceOf(rapid.StringMatching(`host_[0-9]{6}`)).Draw(t, "hostnames")
+		bufferSize := rapid.IntRange(1, 100).Draw(t, "bufferSize")
+		seed := rapid.Int64().Draw(t, "seed")
+
+		read := func() []string {
+			reader, err := NewShuffleReader(&testSliceReader{queries: testQueries(hostnames...)}, bufferSize, seed)
+			assert.NoError(t, err)
+			shuffled, errs := readHostnames(t, reader)
+			assert.Zero(t, errs)
+			return shuffled
+		}
+
+		shuffled := read()
+		assert.Equal(t, shuffled, read())
+		assert.ElementsMatch(t, hostnames, shuffled)
+	})
+}
+
+func TestShuffleReaderBreaksHostOrder(t *testing.T) {
+	t.Parallel()
+	hostnames := make([]string, 100)
+	for i := range hostnames {
+		hostnames[i] = fmt.Sprintf("host_%06d", i)
+	}
+
+	reader, err := NewShuffleReader(&testSliceReader{queries: testQueries(hostnames...)}, len(hostnames), 42)
+	assert.NoError(t, err)
+	shuffled, _ := readHostnames(t, reader)
+	assert.ElementsMatch(t, hostnames, shuffled)
+	assert.False(t, slices.IsSorted(shuffled))
+
+	_, err = NewShuffleReader(reader, 0, 42)
+	assert.Error(t, err)
+}
+
+// testEndingReader returns the queries of reader, then ends the input with err
+type testEndingReader struct {
+	reader Reader
+	err    error
+}
+
+func (r *testEndingReader) Next() (Query, bool, error) {
+	query, hasMore, err := r.reader.Next()
+	if !hasMore {
+		return Query{}, false, r.err
+	}
+	return query, hasMore, err
+}
+
+func TestShuffleReaderReturnsEndingError(t *testing.T) {
+	t.Parallel()
+	endErr := &RowError{Line: 3, Reason: ReasonMalformedRow, Err: errors.New("bare quote")}
+	reader, err := NewShuffleReader(&testEndingReader{reader: &testSliceReader{queries: testQueries("a", "b")}, err: endErr}, 10, 42)
+	assert.NoError(t, err)
+
+	var hostnames []string
+	for range 2 {
+		query, hasMore, err := reader.Next()
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+		hostnames = append(hostnames, query.Hostname)
+	}
+	assert.ElementsMatch(t, []string{"a", "b"}, hostnames)
+
+	// the error comes after the last buffered query, once
+	_, hasMore, err := reader.Next()
+	assert.False(t, hasMore)
+	assert.ErrorIs(t, err, endErr)
+	_, hasMore, err = reader.Next()
+	assert.False(t, hasMore)
+	assert.NoError(t, err)
+}
+
+type testLoopCloser struct {
+	closed *int
+}
+
+func (c testLoopCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestLoopReaderTimes(t *testing.T) {
+	t.Parallel()
+	closed := 0
+	open := func() (Reader, io.Closer, error) {
+		return &testSliceReader{queries: testQueries("a", "", "b")}, testLoopCloser{closed: &closed}, nil
+	}
+
+	reader, err := NewLoopReader(open, 3, 0)
+	assert.NoError(t, err)
+	hostnames, errs := readHostnames(t, reader)
+	assert.Equal(t, []string{"a", "b", "a", "b", "a", "b"}, hostnames)
+	assert.Equal(t, 3, errs)
+	assert.Equal(t, 3, reader.Passes())
+	assert.Equal(t, 3, closed)
+}
+
+func TestLoopReaderDuration(t *testing.T) {
+	t.Parallel()
+	open := func() (Reader, io.Closer, error) {
+		return &testSliceReader{queries: testQueries("a", "b", "c")}, nil, nil
+	}
+
+	reader, err := NewLoopReader(open, 0, time.Minute)
+	assert.NoError(t, err)
+
+	// every query takes 10 seconds, so 6 queries fit in a minute
+	now := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	reader.start = now
+	reader.now = func() time.Time {
+		return now
+	}
+	var hostnames []string
+	for {
+		query, hasMore, err := reader.Next()
+		assert.NoError(t, err)
+		if !hasMore {
+			break
+		}
+		hostnames = append(hostnames, query.Hostname)
+		now = now.Add(10 * time.Second)
+	}
+	assert.Equal(t, []string{"a", "b", "c", "a", "b", "c"}, hostnames)
+	assert.Equal(t, 2, reader.Passes())
+}
+
+func TestLoopReaderEmptyInput(t *testing.T) {
+	t.Parallel()
+	open := func() (Reader, io.Closer, error) {
+		return &testSliceReader{queries: testQueries("")}, nil, nil
+	}
+
+	reader, err := NewLoopReader(open, 0, 0)
+	assert.NoError(t, err)
+	hostnames, errs := readHostnames(t, reader)
+	assert.Empty(t, hostnames)
+	assert.Equal(t, 1, errs)
+	assert.Equal(t, 1, reader.Passes())
+}
+
+func TestLoopReaderOpenError(t *testing.T) {
+	t.Parallel()
+	passes := 0
+	open := func() (Reader, io.Closer, error) {
+		passes++
+		if passes > 1 {
+			return nil, nil, errors.New("file removed")
+		}
+		return &testSliceReader{queries: testQueries("a")}, nil, nil
+	}
+
+	reader, err := NewLoopReader(open, 0, 0)
+	assert.NoError(t, err)
+	_, _, err = reader.Next()
+	assert.NoError(t, err)
+	_, hasMore, err := reader.Next()
+	assert.False(t, hasMore)
+	assert.EqualError(t, err, "error opening loop pass 2: file removed")
+}
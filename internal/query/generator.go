@@ -0,0 +1,254 @@
+package query
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Popularity is how hosts are picked for each generated query
+type Popularity string
+
+const (
+	// PopularityUniform picks every host with the same probability
+	PopularityUniform Popularity = "uniform"
+	// PopularityZipf picks host i with probability proportional to 1/(i+1)^s, host 0 is the most popular
+	PopularityZipf Popularity = "zipf"
+	// PopularityHotSet picks a host of the hot set with probability HotSetProbability, the hot set are the first hosts
+	PopularityHotSet Popularity = "hotset"
+)
+
+// WindowDistribution is how the length of each generated time window is picked
+type WindowDistribution string
+
+const (
+	// WindowFixed uses Window for every query
+	WindowFixed WindowDistribution = "fixed"
+	// WindowUniform picks a length between MinWindow and MaxWindow
+	WindowUniform WindowDistribution = "uniform"
+	// WindowExponential picks MinWindow plus an exponential length with mean Window, capped at MaxWindow
+	WindowExponential WindowDistribution = "exponential"
+)
+
+// GeneratorSpec describes a synthetic workload
+// The same spec always generates the same queries, the Seed makes runs exactly reproducible
+type GeneratorSpec struct {
+	Seed int64
+	// Count is the number of queries to generate, 0 generates forever
+	Count int
+
+	// Hosts is the size of the host population, hosts are named by formatting HostPattern with the host index
+	Hosts       int
+	HostPattern string
+
+	Popularity Popularity
+	// ZipfS is the Zipf exponent, must be greater than 1
+	ZipfS float64
+	// HotSetFraction of the hosts receive HotSetProbability of the queries
+	HotSetFraction    float64
+	HotSetProbability float64
+
+	WindowDistribution WindowDistribution
+	Window             time.Duration
+	MinWindow          time.Duration
+	MaxWindow          time.Duration
+
+	// RangeStart and RangeEnd bound every generated window
+	RangeStart time.Time
+	RangeEnd   time.Time
+}
+
+// DefaultGeneratorSpec matches resources/query_params.csv: 20 hosts queried uniformly over one hour windows of the dataset
+func DefaultGeneratorSpec() GeneratorSpec {
+	return GeneratorSpec{
+		Seed:               1,
+		Count:              1000,
+		Hosts:              20,
+		HostPattern:        "host_%06d",
+		Popularity:         PopularityUniform,
+		ZipfS:              1.1,
+		HotSetFraction:     0.1,
+		HotSetProbability:  0.9,
+		WindowDistribution: WindowFixed,
+		Window:             time.Hour,
+		MinWindow:          time.Minute,
+		MaxWindow:          6 * time.Hour,
+		RangeStart:         time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		RangeEnd:           time.Date(2017, 1, 3, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+// ParseGeneratorSpec parses a comma separated list of key=value pairs on top of DefaultGeneratorSpec, e.g.
+// seed=42,count=5000,hosts=100,popularity=zipf,zipf-s=1.2,window-distribution=uniform,min-window=1m,max-window=2h
+// Keys are seed, count, hosts, host-pattern, popularity, zipf-s, hot-fraction, hot-probability,
+// window-distribution, window, min-window, max-window, start and end (RFC3339)
+func ParseGeneratorSpec(value string) (GeneratorSpec, error) {
+	spec := DefaultGeneratorSpec()
+	if strings.TrimSpace(value) == "" {
+		return spec, nil
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		key, raw, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return GeneratorSpec{}, fmt.Errorf("invalid generator spec %q: expected key=value", pair)
+		}
+
+		var err error
+		switch key {
+		case "seed":
+			spec.Seed, err = strconv.ParseInt(raw, 10, 64)
+		case "count":
+			spec.Count, err = strconv.Atoi(raw)
+		case "hosts":
+			spec.Hosts, err = strconv.Atoi(raw)
+		case "host-pattern":
+			spec.HostPattern = raw
+		case "popularity":
+			spec.Popularity = Popularity(raw)
+		case "zipf-s":
+			spec.ZipfS, err = strconv.ParseFloat(raw, 64)
+		case "hot-fraction":
+			spec.HotSetFraction, err = strconv.ParseFloat(raw, 64)
+		case "hot-probability":
+			spec.HotSetProbability, err = strconv.ParseFloat(raw, 64)
+		case "window-distribution":
+			spec.WindowDistribution = WindowDistribution(raw)
+		case "window":
+			spec.Window, err = time.ParseDuration(raw)
+		case "min-window":
+			spec.MinWindow, err = time.ParseDuration(raw)
+		case "max-window":
+			spec.MaxWindow, err = time.ParseDuration(raw)
+		case "start":
+			spec.RangeStart, err = time.Parse(time.RFC3339, raw)
+		case "end":
+			spec.RangeEnd, err = time.Parse(time.RFC3339, raw)
+		default:
+			return GeneratorSpec{}, fmt.Errorf("invalid generator spec: unknown key %q", key)
+		}
+		if err != nil {
+			return GeneratorSpec{}, fmt.Errorf("invalid generator spec %s: %w", key, err)
+		}
+	}
+
+	return spec, nil
+}
+
+// Generator is a query Reader producing a synthetic workload from a GeneratorSpec
+type Generator struct {
+	spec      GeneratorSpec
+	random    *rand.Rand
+	zipf      *rand.Zipf
+	generated int
+	hotHosts  int
+}
+
+// NewGenerator validates the spec and creates a new Generator
+func NewGenerator(spec GeneratorSpec) (*Generator, error) {
+	if spec.Count < 0 {
+		return nil, fmt.Errorf("count must be greater or equal than 0")
+	}
+	if spec.Hosts < 1 {
+		return nil, fmt.Errorf("hosts must be greater than 0")
+	}
+	if !strings.Contains(spec.HostPattern, "%") {
+		return nil, fmt.Errorf("host pattern %q must contain a verb for the host index, e.g. host_%%06d", spec.HostPattern)
+	}
+	if !spec.RangeStart.Before(spec.RangeEnd) {
+		return nil, fmt.Errorf("range start %s must be before range end %s", spec.RangeStart, spec.RangeEnd)
+	}
+
+	rangeLength := spec.RangeEnd.Sub(spec.RangeStart)
+	switch spec.WindowDistribution {
+	case WindowFixed:
+		if spec.Window <= 0 || spec.Window > rangeLength {
+			return nil, fmt.Errorf("window %v must be greater than 0 and fit in the range %v", spec.Window, rangeLength)
+		}
+	case WindowUniform, WindowExponential:
+		if spec.MinWindow < 0 || spec.MinWindow > spec.MaxWindow || spec.MaxWindow > rangeLength {
+			return nil, fmt.Errorf("windows must be 0 <= min window %v <= max window %v <= range %v", spec.MinWindow, spec.MaxWindow, rangeLength)
+		}
+		if spec.WindowDistribution == WindowExponential && spec.Window <= 0 {
+			return nil, fmt.Errorf("window %v, the mean of the exponential distribution, must be greater than 0", spec.Window)
+		}
+	default:
+		return nil, fmt.Errorf("unknown window distribution %q, expected fixed, uniform or exponential", spec.WindowDistribution)
+	}
+
+	random := rand.New(rand.NewSource(spec.Seed)) //nolint:gosec
+	generator := &Generator{spec: spec, random: random}
+
+	switch spec.Popularity {
+	case PopularityUniform:
+	case PopularityZipf:
+		if spec.ZipfS <= 1 {
+			return nil, fmt.Errorf("zipf s %v must be greater than 1", spec.ZipfS)
+		}
+		generator.zipf = rand.NewZipf(random, spec.ZipfS, 1, uint64(spec.Hosts-1)) //nolint:gosec
+	case PopularityHotSet:
+		if spec.HotSetFraction <= 0 || spec.HotSetFraction > 1 || spec.HotSetProbability < 0 || spec.HotSetProbability > 1 {
+			return nil, fmt.Errorf("hot set fraction %v must be in (0, 1] and probability %v in [0, 1]", spec.HotSetFraction, spec.HotSetProbability)
+		}
+		generator.hotHosts = max(1, int(math.Round(spec.HotSetFraction*float64(spec.Hosts))))
+	default:
+		return nil, fmt.Errorf("unknown popularity %q, expected uniform, zipf or hotset", spec.Popularity)
+	}
+
+	return generator, nil
+}
+
+// Next generates the next query
+// Returns the query and a boolean indicating if there are more queries, generated queries are always valid
+func (g *Generator) Next() (Query, bool, error) {
+	if g.spec.Count > 0 && g.generated >= g.spec.Count {
+		return Query{}, false, nil
+	}
+	g.generated++
+
+	hostname := fmt.Sprintf(g.spec.HostPattern, g.host())
+	window := g.window()
+	latestStart := g.spec.RangeEnd.Sub(g.spec.RangeStart) - window
+	// timestamps are generated with second precision, like the sample dataset
+	offset := time.Duration(g.random.Int63n(int64(latestStart/time.Second)+1)) * time.Second
+	startTime := g.spec.RangeStart.Add(offset).UTC()
+
+	return Query{
+		Hostname:  hostname,
+		StartTime: startTime,
+		EndTime:   startTime.Add(window),
+	}, true, nil
+}
+
+// host picks the index of the host for the next query
+func (g *Generator) host() int {
+	switch g.spec.Popularity {
+	case PopularityZipf:
+		return int(g.zipf.Uint64()) //nolint:gosec
+	case PopularityHotSet:
+		coldHosts := g.spec.Hosts - g.hotHosts
+		if coldHosts == 0 || g.random.Float64() < g.spec.HotSetProbability {
+			return g.random.Intn(g.hotHosts)
+		}
+		return g.hotHosts + g.random.Intn(coldHosts)
+	default:
+		return g.random.Intn(g.spec.Hosts)
+	}
+}
+
+// window picks the length of the next time window, truncated to seconds
+func (g *Generator) window() time.Duration {
+	var window time.Duration
+	switch g.spec.WindowDistribution {
+	case WindowUniform:
+		window = g.spec.MinWindow + time.Duration(g.random.Int63n(int64(g.spec.MaxWindow-g.spec.MinWindow)+1))
+	case WindowExponential:
+		window = min(g.spec.MinWindow+time.Duration(g.random.ExpFloat64()*float64(g.spec.Window)), g.spec.MaxWindow)
+	default:
+		window = g.spec.Window
+	}
+	return window.Truncate(time.Second)
+}
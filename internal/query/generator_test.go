@@ -0,0 +1,161 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+func drawGeneratorSpec(t *rapid.T) GeneratorSpec {
+	spec := DefaultGeneratorSpec()
+	spec.Seed = rapid.Int64().Draw(t, "seed")
+	spec.Count = rapid.IntRange(1, 500).Draw(t, "count")
+	spec.Hosts = rapid.IntRange(1, 100).Draw(t, "hosts")
+	spec.Popularity = rapid.SampledFrom([]Popularity{PopularityUniform, PopularityZipf, PopularityHotSet}).Draw(t, "popularity")
+	spec.WindowDistribution = rapid.SampledFrom([]WindowDistribution{WindowFixed, WindowUniform, WindowExponential}).Draw(t, "windowDistribution")
+	return spec
+}
+
+func generateAll(t assert.TestingT, spec GeneratorSpec) []Query {
+	generator, err := NewGenerator(spec)
+	assert.NoError(t, err)
+
+	var queries []Query
+	for {
+		query, hasMore, err := generator.Next()
+		assert.NoError(t, err)
+		if !hasMore {
+			return queries
+		}
+		queries = append(queries, query)
+	}
+}
+
+func TestGeneratorIsReproducibleProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		spec := drawGeneratorSpec(t)
+		assert.Equal(t, generateAll(t, spec), generateAll(t, spec))
+	})
+}
+
+func TestGeneratorRespectsSpecProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		spec := drawGeneratorSpec(t)
+		queries := generateAll(t, spec)
+		assert.Len(t, queries, spec.Count)
+
+		hostnames := make(map[string]bool, spec.Hosts)
+		for i := range spec.Hosts {
+			hostnames[fmt.Sprintf(spec.HostPattern, i)] = true
+		}
+
+		for _, query := range queries {
+			assert.True(t, hostnames[query.Hostname], query.Hostname)
+			assert.False(t, query.StartTime.Before(spec.RangeStart))
+			assert.False(t, query.EndTime.After(spec.RangeEnd))
+
+			window := query.EndTime.Sub(query.StartTime)
+			switch spec.WindowDistribution {
+			case WindowFixed:
+				assert.Equal(t, spec.Window, window)
+			default:
+				assert.GreaterOrEqual(t, window, spec.MinWindow)
+				assert.LessOrEqual(t, window, spec.MaxWindow)
+			}
+		}
+	})
+}
+
+func TestGeneratorPopularity(t *testing.T) {
+	t.Parallel()
+	spec := DefaultGeneratorSpec()
+	spec.Count = 10_000
+	spec.Hosts = 100
+
+	spec.Popularity = PopularityZipf
+	counts := make(map[string]int)
+	for _, query := range generateAll(t, spec) {
+		counts[query.Hostname]++
+	}
+	assert.Greater(t, counts["host_000000"], counts["host_000001"])
+	assert.Greater(t, counts["host_000001"], counts["host_000010"])
+
+	spec.Popularity = PopularityHotSet
+	hot := 0
+	for _, query := range generateAll(t, spec) {
+		if query.Hostname < "host_000010" {
+			hot++
+		}
+	}
+	assert.InDelta(t, 0.9, float64(hot)/float64(spec.Count), 0.02)
+}
+
+func TestGeneratorForever(t *testing.T) {
+	t.Parallel()
+	spec := DefaultGeneratorSpec()
+	spec.Count = 0
+
+	generator, err := NewGenerator(spec)
+	assert.NoError(t, err)
+	for range 100_000 {
+		_, hasMore, err := generator.Next()
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+	}
+}
+
+func TestGeneratorSnapshot(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseGeneratorSpec("seed=42,count=3,hosts=10,popularity=zipf,window-distribution=uniform,min-window=1m,max-window=2h")
+	assert.NoError(t, err)
+	for _, query := range generateAll(t, spec) {
+		snaps.MatchSnapshot(t, query.Build())
+	}
+}
+
+func TestParseGeneratorSpec(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseGeneratorSpec("seed=7, hosts=5,host-pattern=db-%d,popularity=hotset,hot-fraction=0.2,start=2020-01-01T00:00:00Z,end=2020-01-02T00:00:00Z")
+	assert.NoError(t, err)
+
+	expected := DefaultGeneratorSpec()
+	expected.Seed = 7
+	expected.Hosts = 5
+	expected.HostPattern = "db-%d"
+	expected.Popularity = PopularityHotSet
+	expected.HotSetFraction = 0.2
+	expected.RangeStart = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected.RangeEnd = time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, expected, spec)
+}
+
+func TestGeneratorSpecErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, value := range []string{
+		"seed",
+		"seeds=1",
+		"count=ten",
+		"hosts=0",
+		"host-pattern=host",
+		"popularity=pareto",
+		"popularity=zipf,zipf-s=1",
+		"popularity=hotset,hot-fraction=2",
+		"window-distribution=normal",
+		"window=72h",
+		"window-distribution=uniform,min-window=2h,max-window=1h",
+		"start=2017-01-03T00:00:00Z",
+	} {
+		spec, err := ParseGeneratorSpec(value)
+		if err == nil {
+			_, err = NewGenerator(spec)
+		}
+		assert.Error(t, err, value)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
@@ -0,0 +1,113 @@
+package query
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+)
+
+// jsonMaxLineSize is the longest NDJSON line accepted, a capture line is usually a few hundred bytes
+const jsonMaxLineSize = 1024 * 1024
+
+// JSONReader is a simple iterator for reading NDJSON (JSON Lines) queries
+// Every line is an object with the same fields as the CSV columns, e.g.
+// {"hostname": "host_000001", "start_time": "2017-01-01 08:59:22", "end_time": "2017-01-01 09:59:22"}
+// Fields are parsed like CSV values, numbers can be used for unix timestamps. Blank lines are ignored
+type JSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+	parser  *rowParser
+}
+
+// NewJSONReader creates a new NDJSON query reader for the default cpu_usage query
+func NewJSONReader(reader io.Reader) (*JSONReader, error) {
+	return NewJSONReaderWithOptions(reader, Options{})
+}
+
+// NewJSONReaderWithOptions creates a new NDJSON query reader
+// Delimiter and Comment do not apply to NDJSON and are ignored
+func NewJSONReaderWithOptions(reader io.Reader, options Options) (*JSONReader, error) {
+	parser, err := newRowParser(options)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), jsonMaxLineSize)
+
+	return &JSONReader{scanner: scanner, parser: parser}, nil
+}
+
+// Next reads the next query from the NDJSON input
+// Returns the query and a boolean indicating if there are more queries
+// Skips errors when reading invalid lines, errors for skipped lines are a *RowError
+func (r *JSONReader) Next() (Query, bool, error) {
+	var raw []byte
+	for len(raw) == 0 {
+		if !r.scanner.Scan() {
+			if err := r.scanner.Err(); err != nil {
+				return Query{}, false, &RowError{
+					Line:   r.line + 1,
+					Reason: ReasonMalformedRow,
+					Err:    fmt.Errorf("error reading NDJSON line: %w on line %d", err, r.line+1),
+				}
+			}
+			return Query{}, false, nil
+		}
+		r.line++
+		raw = bytes.TrimSpace(r.scanner.Bytes())
+	}
+	record := []string{string(raw)}
+
+	values, err := jsonValues(raw)
+	if err != nil {
+		return Query{}, true, r.rowError(ReasonMalformedRow, record, fmt.Errorf("invalid NDJSON object: %w on line %d", err, r.line))
+	}
+
+	if missing := r.parser.missing(slices.Collect(maps.Keys(values))); len(missing) > 0 {
+		return Query{}, true, r.rowError(ReasonMalformedRow, record, fmt.Errorf("missing required fields %v on line %d", missing, r.line))
+	}
+
+	query, reason, err := r.parser.parse(values, r.line)
+	if err != nil {
+		return Query{}, true, r.rowError(reason, record, err)
+	}
+
+	return query, true, nil
+}
+
+func (r *JSONReader) rowError(reason Reason, record []string, err error) *RowError {
+	return &RowError{Line: r.line, Reason: reason, Record: record, Err: err}
+}
+
+// jsonValues decodes a JSON object into its raw values
+// Strings are unquoted, numbers and booleans keep their text and nested values are kept as JSON
+// null is treated as a missing field
+func jsonValues(raw []byte) (map[string]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(object))
+	for name, value := range object {
+		switch {
+		case string(value) == "null":
+			continue
+		case len(value) > 0 && value[0] == '"':
+			var unquoted string
+			if err := json.Unmarshal(value, &unquoted); err != nil {
+				return nil, fmt.Errorf("invalid field %s: %w", name, err)
+			}
+			values[name] = unquoted
+		default:
+			values[name] = string(value)
+		}
+	}
+
+	return values, nil
+}
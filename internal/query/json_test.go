@@ -0,0 +1,116 @@
+package query
+
+import (
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONReaderSnapshot(t *testing.T) {
+	t.Parallel()
+	inputFile, err := os.Open("../../resources/query_params.ndjson")
+	assert.NoError(t, err)
+	defer inputFile.Close()
+
+	options := Options{TimeFormats: []string{FormatDateTime, FormatRFC3339, FormatUnix}, PassThrough: true}
+	reader, err := NewJSONReaderWithOptions(inputFile, options)
+	assert.NoError(t, err)
+
+	// line 1: valid
+	query, hasMore, err := reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Empty(t, query.Extra)
+	snaps.MatchSnapshot(t, query.Build())
+
+	// line 2: valid with mixed timestamp formats and an extra field
+	query, hasMore, err = reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, map[string]string{"dashboard": "ops"}, query.Extra)
+	snaps.MatchSnapshot(t, query.Build())
+
+	// line 3: blank, line 4: invalid value, line 5: missing field, line 6: invalid JSON
+	for _, expected := range []Reason{ReasonInvalidValue, ReasonMalformedRow, ReasonMalformedRow} {
+		query, hasMore, err = reader.Next()
+		assert.Error(t, err)
+		assert.Empty(t, query)
+		assert.True(t, hasMore)
+		assert.Equal(t, expected, ReasonOf(err))
+		snaps.MatchSnapshot(t, err.Error())
+	}
+
+	// line 7: nested values are passed through as JSON
+	query, hasMore, err = reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, map[string]string{"tags": `{"tenant": "A"}`}, query.Extra)
+
+	_, hasMore, err = reader.Next()
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+}
+
+// The same rows must build the same queries from CSV and NDJSON
+func TestJSONReaderMatchesCSVReader(t *testing.T) {
+	t.Parallel()
+	csvFile, err := os.Open("../../resources/query_params.csv")
+	assert.NoError(t, err)
+	defer csvFile.Close()
+
+	csvReader, err := NewQueryReader(csv.NewReader(csvFile))
+	assert.NoError(t, err)
+
+	ndjson := strings.Builder{}
+	var expected []string
+	for {
+		query, hasMore, err := csvReader.Next()
+		assert.NoError(t, err)
+		if !hasMore {
+			break
+		}
+		expected = append(expected, query.Build())
+		ndjson.WriteString(`{"hostname":"` + query.Hostname + `","start_time":"` + query.StartTime.Format(timeLayout) +
+			`","end_time":"` + query.EndTime.Format(timeLayout) + `"}` + "\n")
+	}
+
+	jsonReader, err := NewJSONReader(strings.NewReader(ndjson.String()))
+	assert.NoError(t, err)
+	var actual []string
+	for {
+		query, hasMore, err := jsonReader.Next()
+		assert.NoError(t, err)
+		if !hasMore {
+			break
+		}
+		actual = append(actual, query.Build())
+	}
+
+	assert.Len(t, actual, 200)
+	assert.Equal(t, expected, actual)
+}
+
+func TestJSONReaderTemplate(t *testing.T) {
+	t.Parallel()
+	ndjson := `{"hostname": "host_000001", "threshold": 90.5, "limit": 10}` + "\n" +
+		`{"hostname": "host_000002", "threshold": "high", "limit": 10}` + "\n"
+
+	template := MustParseTemplate("SELECT * FROM cpu_usage WHERE host = {{hostname}} AND usage > {{threshold:float}} LIMIT {{limit:int}}")
+	reader, err := NewJSONReaderWithOptions(strings.NewReader(ndjson), Options{Template: template})
+	assert.NoError(t, err)
+
+	query, hasMore, err := reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, "host_000001", query.Hostname)
+	assert.Equal(t, "SELECT * FROM cpu_usage WHERE host = 'host_000001' AND usage > 90.5 LIMIT 10", query.Build())
+
+	_, hasMore, err = reader.Next()
+	assert.Error(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, ReasonInvalidValue, ReasonOf(err))
+}
@@ -0,0 +1,195 @@
+package query
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// QueryType is the shape of the SQL built for a Query, modeled after the TSBS devops queries
+type QueryType string
+
+const (
+	// TypeSingleHost selects every row of one host in the window, the default
+	TypeSingleHost QueryType = "single-host"
+	// TypeMaxPerMinute is the per minute max usage of one host in the window
+	TypeMaxPerMinute QueryType = "max-per-minute"
+	// TypeLastPoint is the last reading of each host in Query.Hosts, in any window
+	TypeLastPoint QueryType = "lastpoint"
+	// TypeGroupByHosts is the hourly average usage of each host in Query.Hosts in the window
+	TypeGroupByHosts QueryType = "groupby-hosts"
+	// TypeHighCPU selects the readings of one host in the window above HighCPUThreshold
+	TypeHighCPU QueryType = "high-cpu"
+	// TypeTemplate is the type of queries built from a user Template
+	TypeTemplate QueryType = "template"
+)
+
+// HighCPUThreshold is the usage above which a reading is high CPU, the same threshold as TSBS
+const HighCPUThreshold = 90.0
+
+// QueryTypes are the types a Mix can pick from
+var QueryTypes = []QueryType{TypeSingleHost, TypeMaxPerMinute, TypeLastPoint, TypeGroupByHosts, TypeHighCPU}
+
+var (
+	maxPerMinuteTemplate = MustParseTemplate(
+		"SELECT time_bucket('1 minute', ts) AS minute, max(usage) FROM cpu_usage WHERE host = {{hostname}} AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}} GROUP BY minute ORDER BY minute")
+	highCPUTemplate = MustParseTemplate(
+		"SELECT * FROM cpu_usage WHERE host = {{hostname}} AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}} AND usage > {{threshold:float}}")
+	lastPointTemplate = MustParseTemplate(
+		"SELECT DISTINCT ON (host) host, ts, usage FROM cpu_usage WHERE host IN ({{hosts}}) ORDER BY host, ts DESC")
+	groupByHostsTemplate = MustParseTemplate(
+		"SELECT time_bucket('1 hour', ts) AS hour, host, avg(usage) FROM cpu_usage WHERE host IN ({{hosts}}) AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}} GROUP BY hour, host ORDER BY hour, host")
+)
+
+// Mix is a weighted set of query types
+type Mix struct {
+	types   []QueryType
+	weights []int
+	total   int
+}
+
+// ParseMix parses a comma separated list of type=weight, e.g. single-host=5,max-per-minute=2,lastpoint=1
+// Weights are relative, a type with weight 0 is never picked
+func ParseMix(value string) (Mix, error) {
+	mix := Mix{}
+	for _, pair := range strings.Split(value, ",") {
+		name, rawWeight, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found {
+			return Mix{}, fmt.Errorf("invalid mix %q: expected type=weight", pair)
+		}
+
+		queryType := QueryType(name)
+		if !slices.Contains(QueryTypes, queryType) {
+			return Mix{}, fmt.Errorf("invalid mix: unknown query type %q, expected one of %v", name, QueryTypes)
+		}
+		if slices.Contains(mix.types, queryType) {
+			return Mix{}, fmt.Errorf("invalid mix: duplicated query type %q", name)
+		}
+
+		weight, err := strconv.Atoi(rawWeight)
+		if err != nil || weight < 0 {
+			return Mix{}, fmt.Errorf("invalid mix: weight of %s must be a positive integer, got %q", name, rawWeight)
+		}
+
+		mix.types = append(mix.types, queryType)
+		mix.weights = append(mix.weights, weight)
+		mix.total += weight
+	}
+
+	if mix.total == 0 {
+		return Mix{}, fmt.Errorf("invalid mix %q: weights must add up to more than 0", value)
+	}
+
+	return mix, nil
+}
+
+// pick returns the type for n, a number in [0, total)
+func (m Mix) pick(n int) QueryType {
+	for i, weight := range m.weights {
+		if n < weight {
+			return m.types[i]
+		}
+		n -= weight
+	}
+	return m.types[len(m.types)-1]
+}
+
+// MixReader is a query Reader that assigns a type of the Mix to each query of the underlying reader
+// Multi host types query the row hostname plus other hostnames seen so far, up to groupHosts hosts
+// Template queries and errors are passed through untouched
+type MixReader struct {
+	reader     Reader
+	mix        Mix
+	random     *rand.Rand
+	groupHosts int
+	seen       map[string]bool
+	hostnames  []string
+}
+
+// maxMixHostnames bounds the memory of the hostnames a MixReader remembers for multi host queries
+const maxMixHostnames = 1_000
+
+// NewMixReader creates a new MixReader, the seed makes the picked types reproducible
+func NewMixReader(reader Reader, mix Mix, seed int64, groupHosts int) (*MixReader, error) {
+	if groupHosts < 1 {
+		return nil, fmt.Errorf("group hosts must be greater than 0")
+	}
+
+	return &MixReader{
+		reader:     reader,
+		mix:        mix,
+		random:     rand.New(rand.NewSource(seed)), //nolint:gosec
+		groupHosts: groupHosts,
+		seen:       make(map[string]bool),
+	}, nil
+}
+
+// Next reads the next query and assigns its type
+func (r *MixReader) Next() (Query, bool, error) {
+	query, hasMore, err := r.reader.Next()
+	if err != nil || !hasMore || query.Template != nil {
+		return query, hasMore, err
+	}
+
+	if !r.seen[query.Hostname] && len(r.hostnames) < maxMixHostnames {
+		r.seen[query.Hostname] = true
+		r.hostnames = append(r.hostnames, query.Hostname)
+	}
+
+	query.Type = r.mix.pick(r.random.Intn(r.mix.total))
+	if query.Type == TypeLastPoint || query.Type == TypeGroupByHosts {
+		query.Hosts = r.pickHosts(query.Hostname)
+	}
+
+	return query, true, nil
+}
+
+// pickHosts returns hostname plus up to groupHosts-1 distinct other hostnames seen so far
+func (r *MixReader) pickHosts(hostname string) []string {
+	hosts := []string{hostname}
+	for _, i := range r.random.Perm(len(r.hostnames)) {
+		if len(hosts) >= r.groupHosts {
+			break
+		}
+		if r.hostnames[i] != hostname {
+			hosts = append(hosts, r.hostnames[i])
+		}
+	}
+
+	return hosts
+}
+
+// build renders the SQL of the query type
+func (q *Query) build() string {
+	params := map[string]any{
+		"hostname":   q.Hostname,
+		"start_time": q.StartTime,
+		"end_time":   q.EndTime,
+	}
+
+	switch q.Type {
+	case TypeMaxPerMinute:
+		return maxPerMinuteTemplate.Render(params)
+	case TypeHighCPU:
+		params["threshold"] = HighCPUThreshold
+		return highCPUTemplate.Render(params)
+	case TypeLastPoint:
+		params["hosts"] = q.hosts()
+		return lastPointTemplate.Render(params)
+	case TypeGroupByHosts:
+		params["hosts"] = q.hosts()
+		return groupByHostsTemplate.Render(params)
+	default:
+		return cpuUsageTemplate.Render(params)
+	}
+}
+
+// hosts returns the hosts of a multi host query, defaults to the query hostname
+func (q *Query) hosts() []string {
+	if len(q.Hosts) == 0 {
+		return []string{q.Hostname}
+	}
+	return q.Hosts
+}
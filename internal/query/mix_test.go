@@ -0,0 +1,127 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+func TestQueryTypesBuildSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, queryType := range QueryTypes {
+		query := Query{
+			Hostname:  "host_000001",
+			StartTime: time.Date(2017, 1, 1, 8, 0, 0, 0, time.UTC),
+			EndTime:   time.Date(2017, 1, 1, 9, 0, 0, 0, time.UTC),
+			Type:      queryType,
+			Hosts:     []string{"host_000001", "host_000002"},
+		}
+		assert.Equal(t, queryType, query.QueryType())
+		snaps.MatchSnapshot(t, query.Build())
+	}
+
+	// multi host types default to the query hostname
+	query := Query{Hostname: "host_000001", Type: TypeLastPoint}
+	snaps.MatchSnapshot(t, query.Build())
+}
+
+func TestQueryTypeDefaults(t *testing.T) {
+	t.Parallel()
+	query := Query{}
+	assert.Equal(t, TypeSingleHost, query.QueryType())
+
+	query = Query{Template: cpuUsageTemplate, Type: TypeHighCPU}
+	assert.Equal(t, TypeTemplate, query.QueryType())
+}
+
+func TestParseMixErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, value := range []string{
+		"",
+		"single-host",
+		"single-host=1,unknown=1",
+		"single-host=1,single-host=2",
+		"single-host=-1",
+		"single-host=0,lastpoint=0",
+	} {
+		_, err := ParseMix(value)
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestMixReaderProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		seed := rapid.Int64().Draw(t, "seed")
+		groupHosts := rapid.IntRange(1, 10).Draw(t, "groupHosts")
+		mix, err := ParseMix("single-host=5,max-per-minute=2,lastpoint=1,groupby-hosts=1,high-cpu=0")
+		assert.NoError(t, err)
+
+		read := func() []Query {
+			spec := DefaultGeneratorSpec()
+			spec.Seed = seed
+			generator, err := NewGenerator(spec)
+			assert.NoError(t, err)
+			reader, err := NewMixReader(generator, mix, seed, groupHosts)
+			assert.NoError(t, err)
+
+			var queries []Query
+			for {
+				query, hasMore, err := reader.Next()
+				assert.NoError(t, err)
+				if !hasMore {
+					return queries
+				}
+				queries = append(queries, query)
+			}
+		}
+
+		queries := read()
+		assert.Equal(t, queries, read())
+
+		for _, query := range queries {
+			assert.NotEqual(t, TypeHighCPU, query.Type)
+			switch query.Type {
+			case TypeLastPoint, TypeGroupByHosts:
+				assert.Equal(t, query.Hostname, query.Hosts[0])
+				assert.LessOrEqual(t, len(query.Hosts), groupHosts)
+				seen := make(map[string]bool)
+				for _, host := range query.Hosts {
+					assert.False(t, seen[host], "duplicated host %s", host)
+					seen[host] = true
+				}
+			default:
+				assert.Empty(t, query.Hosts)
+			}
+		}
+	})
+}
+
+func TestMixReaderWeights(t *testing.T) {
+	t.Parallel()
+	mix, err := ParseMix("single-host=3,lastpoint=1")
+	assert.NoError(t, err)
+
+	spec := DefaultGeneratorSpec()
+	spec.Count = 10_000
+	generator, err := NewGenerator(spec)
+	assert.NoError(t, err)
+	reader, err := NewMixReader(generator, mix, 42, 4)
+	assert.NoError(t, err)
+
+	counts := make(map[QueryType]int)
+	for {
+		query, hasMore, err := reader.Next()
+		assert.NoError(t, err)
+		if !hasMore {
+			break
+		}
+		counts[query.Type]++
+	}
+	assert.Len(t, counts, 2)
+	assert.InDelta(t, 0.75, float64(counts[TypeSingleHost])/float64(spec.Count), 0.02)
+}
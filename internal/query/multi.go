@@ -0,0 +1,108 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Opener opens the query Reader of an input source, the Closer is closed once the source is read
+type Opener func(source string) (Reader, io.Closer, error)
+
+// MultiReader is a query Reader that reads several sources one after the other as a single stream
+// Every source is opened on its own, so each one has its own header and line numbers
+// Errors are tagged with the source they were read from
+type MultiReader struct {
+	sources []string
+	open    Opener
+	next    int
+
+	source  string
+	current Reader
+	closer  io.Closer
+}
+
+// NewMultiReader creates a new MultiReader, the first source is opened right away so its errors are returned here
+// Sources that fail to open later are skipped with ReasonInvalidSource
+func NewMultiReader(sources []string, open Opener) (*MultiReader, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no input sources")
+	}
+
+	reader := &MultiReader{sources: sources, open: open}
+	if err := reader.openNext(); err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", reader.source, err)
+	}
+
+	return reader, nil
+}
+
+// Next reads the next query of the current source, moving to the next source when it is exhausted
+// A read error ending a source is returned with hasMore true when there are more sources
+func (r *MultiReader) Next() (Query, bool, error) {
+	for {
+		if r.current == nil {
+			if r.next >= len(r.sources) {
+				return Query{}, false, nil
+			}
+			if err := r.openNext(); err != nil {
+				return Query{}, true, &RowError{Source: r.source, Reason: ReasonInvalidSource, Err: fmt.Errorf("error opening source: %w", err)}
+			}
+		}
+
+		query, hasMore, err := r.current.Next()
+		if err != nil {
+			err = r.withSource(err)
+		}
+		if hasMore {
+			return query, true, err
+		}
+
+		if closeErr := r.closeCurrent(); closeErr != nil && err == nil {
+			err = r.withSource(closeErr)
+		}
+		if err != nil {
+			return Query{}, r.next < len(r.sources), err
+		}
+	}
+}
+
+// Close closes the current source
+func (r *MultiReader) Close() error {
+	return r.closeCurrent()
+}
+
+func (r *MultiReader) openNext() error {
+	r.source = r.sources[r.next]
+	r.next++
+
+	reader, closer, err := r.open(r.source)
+	if err != nil {
+		return err
+	}
+
+	r.current = reader
+	r.closer = closer
+	return nil
+}
+
+func (r *MultiReader) closeCurrent() error {
+	r.current = nil
+	if r.closer == nil {
+		return nil
+	}
+
+	closer := r.closer
+	r.closer = nil
+	return closer.Close()
+}
+
+// withSource tags the error with the current source
+func (r *MultiReader) withSource(err error) error {
+	var rowErr *RowError
+	if errors.As(err, &rowErr) {
+		rowErr.Source = r.source
+		return rowErr
+	}
+	return &RowError{Source: r.source, Reason: ReasonUnknown, Err: err}
+}
@@ -0,0 +1,85 @@
+package query
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+type testCloser struct {
+	closed *int
+}
+
+func (c testCloser) Close() error {
+	*c.closed++
+	return nil
+}
+
+func TestMultiReaderSnapshot(t *testing.T) {
+	t.Parallel()
+	sources := map[string]string{
+		"a.csv": "hostname,start_time,end_time\n" +
+			"host_000001,2017-01-01 08:59:22,2017-01-01 09:59:22\n" +
+			"host_000002,INVALID TIME HERE,2017-01-02 14:02:02\n",
+		"b.csv": "hostname,invalid\n",
+		"c.csv": "hostname,start_time,end_time\n" +
+			"host_000003,2017-01-02 18:50:28,2017-01-02 19:50:28\n" +
+			"host_000004,2017-01-02 18:50:28,2017-01-02 19:50:28, EXTRA ROW\n",
+		"d.csv": "hostname,start_time,end_time\n" +
+			"host_000005,2017-01-02 11:29:42,2017-01-02 12:29:42\n",
+	}
+	closed := 0
+	open := func(source string) (Reader, io.Closer, error) {
+		content, ok := sources[source]
+		if !ok {
+			return nil, nil, errors.New("file does not exist")
+		}
+		reader, err := NewQueryReader(csv.NewReader(strings.NewReader(content)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, testCloser{closed: &closed}, nil
+	}
+
+	reader, err := NewMultiReader([]string{"a.csv", "b.csv", "missing.csv", "c.csv", "d.csv"}, open)
+	assert.NoError(t, err)
+
+	var hostnames []string
+	var reasons []Reason
+	for {
+		query, hasMore, err := reader.Next()
+		if err != nil {
+			reasons = append(reasons, ReasonOf(err))
+			snaps.MatchSnapshot(t, err.Error())
+		} else if hasMore {
+			hostnames = append(hostnames, query.Hostname)
+		}
+		if !hasMore {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"host_000001", "host_000003", "host_000005"}, hostnames)
+	assert.Equal(t, []Reason{ReasonInvalidValue, ReasonInvalidSource, ReasonInvalidSource, ReasonMalformedRow}, reasons)
+	assert.Equal(t, 3, closed)
+	assert.NoError(t, reader.Close())
+}
+
+func TestMultiReaderFirstSourceErrorSnapshot(t *testing.T) {
+	t.Parallel()
+	open := func(_ string) (Reader, io.Closer, error) {
+		return nil, nil, errors.New("file does not exist")
+	}
+
+	_, err := NewMultiReader([]string{"missing.csv"}, open)
+	assert.Error(t, err)
+	snaps.MatchSnapshot(t, err.Error())
+
+	_, err = NewMultiReader(nil, open)
+	assert.EqualError(t, err, "no input sources")
+}
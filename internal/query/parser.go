@@ -0,0 +1,151 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// rowParser turns the named values of a row into a Query
+// It is shared by the readers so every input format parses and validates rows the same way
+type rowParser struct {
+	template    *Template
+	times       *TimeParser
+	validation  Validation
+	passThrough bool
+	tagColumns  []string
+}
+
+func newRowParser(options Options) (*rowParser, error) {
+	times, err := NewTimeParser(options.TimeFormats, options.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rowParser{
+		template:    options.Template,
+		times:       times,
+		validation:  options.Validation,
+		passThrough: options.PassThrough,
+		tagColumns:  options.TagColumns,
+	}, nil
+}
+
+// required returns the names that every row must have
+func (p *rowParser) required() []string {
+	if p.template == nil {
+		return requiredColumns
+	}
+
+	required := make([]string, 0, len(p.template.Params()))
+	for _, param := range p.template.Params() {
+		required = append(required, param.Name)
+	}
+	return required
+}
+
+// missing returns the required names that are not in names
+func (p *rowParser) missing(names []string) []string {
+	var missing []string
+	for _, name := range p.required() {
+		if !slices.Contains(names, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// parse parses and validates the values of the row on the given line
+// Returns the reason the row is skipped on error
+func (p *rowParser) parse(values map[string]string, line int) (Query, Reason, error) {
+	var query Query
+	var err error
+	if p.template != nil {
+		query, err = p.parseTemplate(values, line)
+	} else {
+		query, err = p.parseDefault(values, line)
+	}
+	if err != nil {
+		return Query{}, ReasonInvalidValue, err
+	}
+
+	if reason, err := p.validation.Validate(query); err != nil {
+		return Query{}, reason, fmt.Errorf("%w on line %d", err, line)
+	}
+
+	if p.passThrough {
+		query.Extra = p.extra(values)
+	}
+	query.Tags = p.tags(values)
+
+	return query, "", nil
+}
+
+// parseDefault reads the values of the default cpu_usage query
+func (p *rowParser) parseDefault(values map[string]string, line int) (Query, error) {
+	rawStartTime := values["start_time"]
+	startTime, err := p.times.Parse(rawStartTime)
+	if err != nil {
+		return Query{}, fmt.Errorf("invalid start_time: %s err: %w on line %d", rawStartTime, err, line)
+	}
+
+	rawEndTime := values["end_time"]
+	endTime, err := p.times.Parse(rawEndTime)
+	if err != nil {
+		return Query{}, fmt.Errorf("invalid end_time: %s err: %w on line %d", rawEndTime, err, line)
+	}
+
+	return Query{
+		Hostname:  values["hostname"],
+		StartTime: startTime,
+		EndTime:   endTime,
+	}, nil
+}
+
+// parseTemplate binds the values to the template placeholders
+// hostname, start_time and end_time are copied to the Query when present so workers can still map hostnames
+func (p *rowParser) parseTemplate(values map[string]string, line int) (Query, error) {
+	params, err := p.template.Bind(values, p.times)
+	if err != nil {
+		return Query{}, fmt.Errorf("%w on line %d", err, line)
+	}
+
+	query := Query{Template: p.template, Params: params}
+	if hostname, ok := params["hostname"].(string); ok {
+		query.Hostname = hostname
+	}
+	if startTime, ok := params["start_time"].(time.Time); ok {
+		query.StartTime = startTime
+	}
+	if endTime, ok := params["end_time"].(time.Time); ok {
+		query.EndTime = endTime
+	}
+
+	return query, nil
+}
+
+// tags returns the non empty values of the tag columns, nil without tags
+func (p *rowParser) tags(values map[string]string) map[string]string {
+	var tags map[string]string
+	for _, column := range p.tagColumns {
+		if value := values[column]; value != "" {
+			if tags == nil {
+				tags = make(map[string]string, len(p.tagColumns))
+			}
+			tags[column] = value
+		}
+	}
+	return tags
+}
+
+// extra returns the values that are not used to build the query
+func (p *rowParser) extra(values map[string]string) map[string]string {
+	required := p.required()
+	extra := make(map[string]string)
+	for name, value := range values {
+		if !slices.Contains(required, name) {
+			extra[name] = value
+		}
+	}
+	return extra
+}
@@ -0,0 +1,325 @@
+package query
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// PGLogFormat is the log_destination of a PostgreSQL log
+type PGLogFormat string
+
+const (
+	// PGLogStderr is the default text log, entries start with log_line_prefix and continue on lines starting with a tab
+	PGLogStderr PGLogFormat = "stderr"
+	// PGLogCSV is the csvlog format, one CSV record per entry
+	PGLogCSV PGLogFormat = "csvlog"
+)
+
+// csvlog columns, see https://www.postgresql.org/docs/current/runtime-config-logging.html#RUNTIME-CONFIG-LOGGING-CSVLOG
+const (
+	csvlogLogTime  = 0
+	csvlogSeverity = 11
+	csvlogMessage  = 13
+	csvlogDetail   = 14
+)
+
+// pgTimeFormats are the timestamp literals found in logged SQL, with and without an offset
+var pgTimeFormats = []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05.999999999-07", FormatDateTime, FormatRFC3339}
+
+var (
+	// pgLogEntryPattern splits a stderr line into log_line_prefix, severity and message
+	pgLogEntryPattern = regexp.MustCompile(`^(.*?)(LOG|DETAIL|STATEMENT|ERROR|WARNING|NOTICE|INFO|DEBUG[1-5]?|HINT|CONTEXT|FATAL|PANIC):  (.*)$`)
+	// pgLogTimePattern finds the %t or %m timestamp of the log_line_prefix
+	pgLogTimePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?(?: [A-Z]+)?`)
+	// pgStatementPattern matches statements logged by log_min_duration_statement or log_statement
+	pgStatementPattern = regexp.MustCompile(`(?s)^(?:duration: ([0-9.]+) ms\s+)?(?:statement|execute [^:]*): (.*)$`)
+	// pgParametersPattern matches the values of the DETAIL line of extended protocol statements
+	pgParametersPattern  = regexp.MustCompile(`\$(\d+) = ('(?:[^']|'')*'|NULL)`)
+	pgPlaceholderPattern = regexp.MustCompile(`\$(\d+)`)
+
+	// singleHostPattern and otherClausePattern match the shape of the default query, aggregates and filters on usage are other queries
+	singleHostPattern  = regexp.MustCompile(`(?is)^\s*SELECT\s+\*\s+FROM\s+cpu_usage\s+WHERE\s`)
+	otherClausePattern = regexp.MustCompile(`(?i)\b(?:usage|GROUP\s+BY|LIMIT|OFFSET|JOIN|UNION)\b`)
+	hostPattern       = regexp.MustCompile(`(?i)\bhost\s*=\s*'((?:[^']|'')*)'`)
+	betweenPattern    = regexp.MustCompile(`(?i)\bts\s+BETWEEN\s+'([^']*)'(?:::\w+)?\s+AND\s+'([^']*)'`)
+	lowerBoundPattern = regexp.MustCompile(`(?i)\bts\s*>=?\s*'([^']*)'`)
+	upperBoundPattern = regexp.MustCompile(`(?i)\bts\s*<=?\s*'([^']*)'`)
+)
+
+// pgLogEntry is a single log message, with its continuation lines
+type pgLogEntry struct {
+	line     int
+	logTime  string
+	severity string
+	message  string
+	detail   string
+}
+
+// PGLogReader is a query Reader that replays the cpu_usage queries of a PostgreSQL log
+// Statements are logged with log_min_duration_statement (e.g. 0 to log every statement) or log_statement = 'all'
+// The hostname and time range are extracted from the literals of single host cpu_usage queries, other statements are ignored
+// Extended protocol statements are read with the parameters of their DETAIL entry
+// With Options.PassThrough, Query.Extra holds the log_time and duration_ms of each statement
+//
+// pg_stat_statements can not be imported: it stores normalized queries with $n placeholders instead of the literal parameters
+type PGLogReader struct {
+	format  PGLogFormat
+	scanner *bufio.Scanner
+	csv     *csv.Reader
+	line    int
+	parser  *rowParser
+
+	// peekedLine and peekedEntry are read ahead to find continuation lines and DETAIL parameters
+	peekedLine  *string
+	peekedEntry *pgLogEntry
+
+	ignored int
+}
+
+// NewPGLogReader creates a new PostgreSQL log reader
+// Timestamp literals are parsed with or without offset when Options.TimeFormats is empty
+func NewPGLogReader(reader io.Reader, format PGLogFormat, options Options) (*PGLogReader, error) {
+	if len(options.TimeFormats) == 0 {
+		options.TimeFormats = pgTimeFormats
+	}
+	parser, err := newRowParser(options)
+	if err != nil {
+		return nil, err
+	}
+	if missing := parser.missing(requiredColumns); len(missing) > 0 {
+		return nil, fmt.Errorf("template parameters %v are not in PostgreSQL logs, expected %v", missing, requiredColumns)
+	}
+
+	pgLogReader := &PGLogReader{format: format, parser: parser}
+	switch format {
+	case PGLogStderr:
+		pgLogReader.scanner = bufio.NewScanner(reader)
+		pgLogReader.scanner.Buffer(make([]byte, 0, 64*1024), jsonMaxLineSize)
+	case PGLogCSV:
+		pgLogReader.csv = csv.NewReader(reader)
+		pgLogReader.csv.FieldsPerRecord = -1
+	default:
+		return nil, fmt.Errorf("unknown PostgreSQL log format %q, expected stderr or csvlog", format)
+	}
+
+	return pgLogReader, nil
+}
+
+// Next reads the next cpu_usage query of the log
+// Returns the query and a boolean indicating if there are more queries
+// Skips errors when reading invalid statements, errors for skipped statements are a *RowError
+func (r *PGLogReader) Next() (Query, bool, error) {
+	for {
+		entry, err := r.nextEntry()
+		if err != nil {
+			var rowErr *RowError
+			switch {
+			case errors.Is(err, io.EOF):
+				return Query{}, false, nil
+			case errors.As(err, &rowErr):
+				return Query{}, true, rowErr
+			default:
+				return Query{}, false, &RowError{Line: r.line, Reason: ReasonMalformedRow, Err: err}
+			}
+		}
+
+		match := pgStatementPattern.FindStringSubmatch(entry.message)
+		if entry.severity != "LOG" || match == nil {
+			continue
+		}
+		duration, statement := match[1], match[2]
+
+		detail := entry.detail
+		if r.format == PGLogStderr && pgPlaceholderPattern.MatchString(statement) {
+			detail = r.detailOf(entry)
+		}
+		statement = bindParameters(statement, detail)
+
+		values, ok := cpuUsageValues(statement)
+		if !ok {
+			r.ignored++
+			continue
+		}
+		values["log_time"] = entry.logTime
+		values["duration_ms"] = duration
+
+		query, reason, err := r.parser.parse(values, entry.line)
+		if err != nil {
+			return Query{}, true, &RowError{Line: entry.line, Reason: reason, Record: []string{statement}, Err: err}
+		}
+		return query, true, nil
+	}
+}
+
+// Ignored returns the number of statements read that are not single host cpu_usage queries
+func (r *PGLogReader) Ignored() int {
+	return r.ignored
+}
+
+// detailOf returns the DETAIL message following the entry, or pushes the next entry back
+func (r *PGLogReader) detailOf(entry pgLogEntry) string {
+	next, err := r.nextEntry()
+	if err != nil {
+		return ""
+	}
+	if next.severity == "DETAIL" {
+		return next.message
+	}
+	r.peekedEntry = &next
+	return entry.detail
+}
+
+func (r *PGLogReader) nextEntry() (pgLogEntry, error) {
+	if r.peekedEntry != nil {
+		entry := *r.peekedEntry
+		r.peekedEntry = nil
+		return entry, nil
+	}
+
+	if r.format == PGLogCSV {
+		return r.nextCSVEntry()
+	}
+	return r.nextStderrEntry()
+}
+
+func (r *PGLogReader) nextCSVEntry() (pgLogEntry, error) {
+	record, err := r.csv.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.line = parseErr.StartLine
+			return pgLogEntry{}, fmt.Errorf("error reading csvlog record: %w on line %d", err, r.line)
+		}
+		return pgLogEntry{}, err
+	}
+	r.line, _ = r.csv.FieldPos(0)
+
+	if len(record) <= csvlogDetail {
+		return pgLogEntry{}, &RowError{Line: r.line, Reason: ReasonMalformedRow, Record: record,
+			Err: fmt.Errorf("invalid csvlog record: expected at least %d fields, got %d on line %d", csvlogDetail+1, len(record), r.line)}
+	}
+
+	return pgLogEntry{
+		line:     r.line,
+		logTime:  record[csvlogLogTime],
+		severity: record[csvlogSeverity],
+		message:  record[csvlogMessage],
+		detail:   record[csvlogDetail],
+	}, nil
+}
+
+// nextStderrEntry reads an entry and its continuation lines, lines before the first entry are ignored
+func (r *PGLogReader) nextStderrEntry() (pgLogEntry, error) {
+	for {
+		line, err := r.nextLine()
+		if err != nil {
+			return pgLogEntry{}, err
+		}
+
+		match := pgLogEntryPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		entry := pgLogEntry{
+			line:     r.line,
+			logTime:  pgLogTimePattern.FindString(match[1]),
+			severity: match[2],
+			message:  match[3],
+		}
+		for {
+			next, err := r.nextLine()
+			if err != nil {
+				break
+			}
+			if !strings.HasPrefix(next, "\t") {
+				r.peekedLine = &next
+				r.line--
+				break
+			}
+			entry.message += "\n" + next[1:]
+		}
+
+		return entry, nil
+	}
+}
+
+func (r *PGLogReader) nextLine() (string, error) {
+	r.line++
+	if r.peekedLine != nil {
+		line := *r.peekedLine
+		r.peekedLine = nil
+		return line, nil
+	}
+
+	if !r.scanner.Scan() {
+		r.line--
+		if err := r.scanner.Err(); err != nil {
+			return "", fmt.Errorf("error reading log line: %w on line %d", err, r.line+1)
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// bindParameters replaces the $n placeholders of the statement with the values of a "parameters: $1 = '...'" detail
+func bindParameters(statement, detail string) string {
+	if !strings.HasPrefix(detail, "parameters: ") {
+		return statement
+	}
+
+	parameters := make(map[string]string)
+	for _, match := range pgParametersPattern.FindAllStringSubmatch(detail, -1) {
+		parameters[match[1]] = match[2]
+	}
+
+	return pgPlaceholderPattern.ReplaceAllStringFunc(statement, func(placeholder string) string {
+		if value, ok := parameters[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// cpuUsageValues extracts the hostname and time range literals of a single host cpu_usage query
+// The range is either ts BETWEEN a AND b or a pair of ts >= a AND ts <= b bounds
+// Only SELECT * queries are replayed, e.g. a time_bucket max(usage) query would run as a different query
+func cpuUsageValues(statement string) (map[string]string, bool) {
+	if !singleHostPattern.MatchString(statement) || otherClausePattern.MatchString(statement) {
+		return nil, false
+	}
+
+	host := hostPattern.FindStringSubmatch(statement)
+	if host == nil {
+		return nil, false
+	}
+
+	values := map[string]string{"hostname": strings.ReplaceAll(host[1], "''", "'")}
+	if between := betweenPattern.FindStringSubmatch(statement); between != nil {
+		values["start_time"], values["end_time"] = between[1], between[2]
+		return values, true
+	}
+
+	lower := lowerBoundPattern.FindStringSubmatch(statement)
+	upper := upperBoundPattern.FindStringSubmatch(statement)
+	if lower == nil || upper == nil {
+		return nil, false
+	}
+	values["start_time"], values["end_time"] = lower[1], upper[1]
+	return values, true
+}
+
+// ParsePGLogFormat returns the log format of a name, used by flags
+func ParsePGLogFormat(name string) (PGLogFormat, error) {
+	switch format := PGLogFormat(name); format {
+	case PGLogStderr, PGLogCSV:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown PostgreSQL log format %q, expected stderr or csvlog", name)
+	}
+}
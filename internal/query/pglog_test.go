@@ -0,0 +1,103 @@
+package query
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+// readPGLog reads every query and error of a PostgreSQL log fixture
+func readPGLog(t *testing.T, path string, format PGLogFormat) ([]Query, []error, *PGLogReader) {
+	inputFile, err := os.Open(path)
+	assert.NoError(t, err)
+	t.Cleanup(func() { inputFile.Close() })
+
+	options := Options{PassThrough: true, Validation: Validation{StartBeforeEnd: true}}
+	reader, err := NewPGLogReader(inputFile, format, options)
+	assert.NoError(t, err)
+
+	var queries []Query
+	var errs []error
+	for {
+		query, hasMore, err := reader.Next()
+		if err != nil {
+			errs = append(errs, err)
+		} else if hasMore {
+			queries = append(queries, query)
+		}
+		if !hasMore {
+			return queries, errs, reader
+		}
+	}
+}
+
+func TestPGLogReaderStderrSnapshot(t *testing.T) {
+	t.Parallel()
+	queries, errs, reader := readPGLog(t, "../../resources/postgresql.log", PGLogStderr)
+
+	// BEGIN, the max per minute and the lastpoint queries are statements, but not single host cpu_usage queries
+	assert.Equal(t, 3, reader.Ignored())
+	assert.Len(t, queries, 3)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, ReasonInvalidValue, ReasonOf(errs[0]))
+
+	for _, query := range queries {
+		snaps.MatchSnapshot(t, query.Build(), query.Extra)
+	}
+	snaps.MatchSnapshot(t, errs[0].Error())
+}
+
+func TestPGLogReaderCSVSnapshot(t *testing.T) {
+	t.Parallel()
+	queries, errs, reader := readPGLog(t, "../../resources/postgresql.csv", PGLogCSV)
+
+	assert.Equal(t, 1, reader.Ignored())
+	assert.Len(t, queries, 2)
+	assert.Equal(t, []Reason{ReasonMalformedRow, ReasonStartAfterEnd}, []Reason{ReasonOf(errs[0]), ReasonOf(errs[1])})
+
+	for _, query := range queries {
+		snaps.MatchSnapshot(t, query.Build(), query.Extra)
+	}
+	for _, err := range errs {
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestPGLogReaderRejectsTemplateParams(t *testing.T) {
+	t.Parallel()
+	template := MustParseTemplate("SELECT * FROM cpu_usage WHERE host = {{hostname}} AND usage > {{threshold:float}}")
+	_, err := NewPGLogReader(bytes.NewReader(nil), PGLogStderr, Options{Template: template})
+	assert.EqualError(t, err, "template parameters [threshold] are not in PostgreSQL logs, expected [hostname start_time end_time]")
+
+	_, err = NewPGLogReader(bytes.NewReader(nil), "jsonlog", Options{})
+	assert.Error(t, err)
+}
+
+func TestCSVWriterRoundTrip(t *testing.T) {
+	t.Parallel()
+	queries, _, _ := readPGLog(t, "../../resources/postgresql.log", PGLogStderr)
+
+	var output bytes.Buffer
+	writer, err := NewCSVWriter(&output, "duration_ms")
+	assert.NoError(t, err)
+	for _, query := range queries {
+		assert.NoError(t, writer.Write(query))
+	}
+	assert.NoError(t, writer.Flush())
+	snaps.MatchSnapshot(t, output.String())
+
+	reader, err := NewQueryReader(csv.NewReader(&output))
+	assert.NoError(t, err)
+	for _, expected := range queries {
+		query, hasMore, err := reader.Next()
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+		assert.Equal(t, expected.Hostname, query.Hostname)
+		assert.True(t, expected.StartTime.Equal(query.StartTime))
+		assert.True(t, expected.EndTime.Equal(query.EndTime))
+	}
+}
@@ -5,9 +5,17 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"time"
 )
 
+// timeLayout is the format of the timestamps in the input CSV
+const timeLayout = "2006-01-02 15:04:05"
+
+// requiredColumns are the columns needed to build the default cpu_usage query
+var requiredColumns = []string{"hostname", "start_time", "end_time"}
+
 // Reader is a simple iterator for reading queries
 type Reader interface {
 	Next() (Query, bool, error)
@@ -18,33 +26,120 @@ type Query struct {
 	Hostname  string    `csv:"hostname"`
 	StartTime time.Time `csv:"start_time"`
 	EndTime   time.Time `csv:"end_time"`
+
+	// Template and Params are only set for template driven workloads, see NewTemplateReader
+	// Params holds the typed value of every template placeholder
+	Template *Template
+	Params   map[string]any
+
+	// Extra holds the columns not used to build the query, only set with Options.PassThrough
+	Extra map[string]string
+
+	// Type is the shape of the SQL to build, defaults to TypeSingleHost, see MixReader
+	// Hosts are the hosts of multi host types, defaults to Hostname
+	Type  QueryType
+	Hosts []string
+
+	// Tags label the query for the metrics breakdown, e.g. dashboard=ops, only set with Options.TagColumns
+	Tags map[string]string
+}
+
+// Options configures how a CSVReader parses its input
+// The zero value reads comma separated files for the default cpu_usage query
+type Options struct {
+	// Delimiter is the field delimiter, defaults to ','
+	Delimiter rune
+	// Comment is the character that starts a comment line, comment lines are ignored. Disabled when 0
+	Comment rune
+	// PassThrough keeps the columns not used by the query in Query.Extra, otherwise they are ignored
+	PassThrough bool
+	// Template is the SQL template to bind each row to, defaults to the cpu_usage query
+	Template *Template
+	// TimeFormats are tried in order to parse timestamps, see NewTimeParser. Defaults to datetime
+	TimeFormats []string
+	// Location is the time zone of timestamps without an offset. Defaults to UTC
+	Location *time.Location
+	// Validation are the semantic checks rows must pass, rows failing them are skipped
+	Validation Validation
+	// TagColumns are the columns copied to Query.Tags, rows with an empty value are not tagged
+	TagColumns []string
 }
 
 // CSVReader is a simple iterator for reading CSV queries
+// Columns are mapped by header name, so they can be in any order and extra columns are allowed
 type CSVReader struct {
 	csvReader *csv.Reader
 	line      int
+	header    []string
+	parser    *rowParser
 }
 
 // NewReader creates a new query reader and validates the headers
 func NewQueryReader(csvReader *csv.Reader) (*CSVReader, error) {
+	return NewQueryReaderWithOptions(csvReader, Options{})
+}
+
+// NewTemplateReader creates a new query reader for a SQL template
+// The CSV header defines the parameter names, every placeholder in the template must be a column
+func NewTemplateReader(csvReader *csv.Reader, template *Template) (*CSVReader, error) {
+	return NewQueryReaderWithOptions(csvReader, Options{Template: template})
+}
+
+// NewQueryReaderWithOptions creates a new query reader and maps the header columns
+// Returns an error listing every required column missing from the header
+func NewQueryReaderWithOptions(csvReader *csv.Reader, options Options) (*CSVReader, error) {
+	if options.Delimiter != 0 {
+		csvReader.Comma = options.Delimiter
+	}
+	if options.Comment != 0 {
+		csvReader.Comment = options.Comment
+	}
+	// rows with a wrong number of fields are skipped in Next, csv.Reader would end the input on them
+	csvReader.FieldsPerRecord = -1
+
+	parser, err := newRowParser(options)
+	if err != nil {
+		return nil, err
+	}
+
 	fields, err := csvReader.Read()
 	if err != nil {
 		return nil, fmt.Errorf("error reading headers: %w", err)
 	}
-	if len(fields) != 3 {
-		return nil, fmt.Errorf("expected 3 fields, got %d", len(fields))
+
+	header := make([]string, len(fields))
+	for i, field := range fields {
+		// exports from spreadsheets often start with a UTF-8 byte order mark
+		if i == 0 {
+			field = strings.TrimPrefix(field, "\ufeff")
+		}
+		field = strings.TrimSpace(field)
+		if slices.Contains(header[:i], field) {
+			return nil, fmt.Errorf("duplicated column %q in header %v", field, fields)
+		}
+		header[i] = field
 	}
-	if fields[0] != "hostname" || fields[1] != "start_time" || fields[2] != "end_time" {
-		return nil, fmt.Errorf("expected fields to be hostname, start_time, end_time, got %v", fields)
+
+	if missing := parser.missing(header); len(missing) > 0 {
+		return nil, fmt.Errorf("missing required columns %v, got %v", missing, header)
+	}
+	for _, column := range options.TagColumns {
+		if !slices.Contains(header, column) {
+			return nil, fmt.Errorf("missing tag column %q, got %v", column, header)
+		}
 	}
 
-	return &CSVReader{csvReader: csvReader, line: 2}, nil
+	return &CSVReader{
+		csvReader: csvReader,
+		line:      2,
+		header:    header,
+		parser:    parser,
+	}, nil
 }
 
 // Next reads the next query from the CSV
 // Returns the query and a boolean indicating if there are more queries
-// Skips errors when reading invalid rows
+// Skips errors when reading invalid rows, errors for skipped rows are a *RowError
 func (r *CSVReader) Next() (Query, bool, error) {
 	defer func() {
 		r.line++
@@ -55,39 +150,78 @@ func (r *CSVReader) Next() (Query, bool, error) {
 		if errors.Is(err, io.EOF) {
 			return Query{}, false, nil
 		}
-		return Query{}, false, fmt.Errorf("error reading CSV record: %w on line %d", err, r.line)
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			r.line = parseErr.StartLine
+		}
+		return Query{}, false, r.rowError(ReasonMalformedRow, record, fmt.Errorf("error reading CSV record: %w on line %d", err, r.line))
 	}
+	// comments and quoted fields spanning lines make the record line differ from the record count
+	r.line, _ = r.csvReader.FieldPos(0)
 
-	if len(record) != 3 {
-		return Query{}, true, fmt.Errorf("invalid CSV record: expected 3 fields, got %d on line %d", len(record), r.line)
+	if len(record) != len(r.header) {
+		return Query{}, true, r.rowError(ReasonMalformedRow, record,
+			fmt.Errorf("invalid CSV record: expected %d fields, got %d on line %d", len(r.header), len(record), r.line))
 	}
 
-	// TODO: we are not validating hostname format
-
-	startTime, err := time.Parse("2006-01-02 15:04:05", record[1])
-	if err != nil {
-		return Query{}, true, fmt.Errorf("invalid start_time: %s err: %w on line %d", record[1], err, r.line)
+	values := make(map[string]string, len(record))
+	for i, column := range r.header {
+		values[column] = record[i]
 	}
 
-	endTime, err := time.Parse("2006-01-02 15:04:05", record[2])
+	query, reason, err := r.parser.parse(values, r.line)
 	if err != nil {
-		return Query{}, true, fmt.Errorf("invalid end_time: %s err: %w on line %d", record[2], err, r.line)
-	}
-
-	query := Query{
-		Hostname:  record[0],
-		StartTime: startTime,
-		EndTime:   endTime,
+		return Query{}, true, r.rowError(reason, record, err)
 	}
 
 	return query, true, nil
 }
 
+func (r *CSVReader) rowError(reason Reason, record []string, err error) *RowError {
+	return &RowError{Line: r.line, Reason: reason, Record: record, Err: err}
+}
+
 // Build transforms the Query struct into the SQL query string
 // We could build the query directly from the .csv file, but a Query struct give us flexibility to add more fields in the future and try different query patterns
+// Queries read with a template render the template, otherwise the SQL of the query type is used
 func (q *Query) Build() string {
-	return fmt.Sprintf("SELECT * FROM cpu_usage WHERE host = '%s' AND ts BETWEEN '%s' AND '%s'",
-		q.Hostname,
-		q.StartTime.UTC().Format("2006-01-02 15:04:05"),
-		q.EndTime.UTC().Format("2006-01-02 15:04:05"))
+	if q.Template != nil {
+		return q.Template.Render(q.Params)
+	}
+
+	return q.build()
+}
+
+// QueryType returns the type the query is built as, used to break down metrics
+func (q *Query) QueryType() QueryType {
+	switch {
+	case q.Template != nil:
+		return TypeTemplate
+	case q.Type == "":
+		return TypeSingleHost
+	default:
+		return q.Type
+	}
+}
+
+// Input formats of NewReader
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// NewReader creates the query reader of an input format: csv, ndjson, or stderr and csvlog PostgreSQL logs
+func NewReader(input io.Reader, format string, options Options) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		return NewQueryReaderWithOptions(csv.NewReader(input), options)
+	case FormatNDJSON:
+		return NewJSONReaderWithOptions(input, options)
+	case string(PGLogStderr), string(PGLogCSV):
+		// timestamps are SQL literals, parsed with or without offset regardless of the time formats
+		options.TimeFormats = nil
+		return NewPGLogReader(input, PGLogFormat(format), options)
+	default:
+		return nil, fmt.Errorf("unknown input format %q, expected csv, ndjson, stderr or csvlog", format)
+	}
 }
@@ -3,6 +3,7 @@ package query
 import (
 	"encoding/csv"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,6 +91,137 @@ func TestQueryInvalidRowSnapshot(t *testing.T) {
 	query, hasMore, err = queryReader.Next()
 	assert.Error(t, err)
 	assert.Empty(t, query)
+	assert.True(t, hasMore)
+	snaps.MatchSnapshot(t, err.Error())
+
+	_, hasMore, err = queryReader.Next()
+	assert.NoError(t, err)
 	assert.False(t, hasMore)
+}
+
+func TestQueryReaderReadsPastRaggedRows(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time\n" +
+		"h1,2017-01-01 08:59:22,2017-01-01 09:59:22\n" +
+		"h2,2017-01-01 08:59:22\n" +
+		"h3,2017-01-01 08:59:22,2017-01-01 09:59:22\n"
+
+	queryReader, err := NewQueryReader(csv.NewReader(strings.NewReader(csvContent)))
+	assert.NoError(t, err)
+
+	var hostnames []string
+	var reasons []Reason
+	for {
+		query, hasMore, err := queryReader.Next()
+		if err != nil {
+			reasons = append(reasons, ReasonOf(err))
+		} else if hasMore {
+			hostnames = append(hostnames, query.Hostname)
+		}
+		if !hasMore {
+			break
+		}
+	}
+
+	assert.Equal(t, []string{"h1", "h3"}, hostnames)
+	assert.Equal(t, []Reason{ReasonMalformedRow}, reasons)
+}
+
+func TestQueryReaderMapsColumnsByHeader(t *testing.T) {
+	t.Parallel()
+	csvContent := "end_time,source,hostname,start_time\n" +
+		"2017-01-01 09:59:22,tsbs,host_000001,2017-01-01 08:59:22\n"
+
+	queryReader, err := NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), Options{PassThrough: true})
+	assert.NoError(t, err)
+
+	query, hasMore, err := queryReader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, "host_000001", query.Hostname)
+	assert.Equal(t, time.Date(2017, 1, 1, 8, 59, 22, 0, time.UTC), query.StartTime)
+	assert.Equal(t, time.Date(2017, 1, 1, 9, 59, 22, 0, time.UTC), query.EndTime)
+	assert.Equal(t, map[string]string{"source": "tsbs"}, query.Extra)
+}
+
+func TestQueryReaderIgnoresExtraColumns(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time,source\n" +
+		"host_000001,2017-01-01 08:59:22,2017-01-01 09:59:22,tsbs\n"
+
+	queryReader, err := NewQueryReader(csv.NewReader(strings.NewReader(csvContent)))
+	assert.NoError(t, err)
+
+	query, hasMore, err := queryReader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Nil(t, query.Extra)
+	assert.Equal(t, "host_000001", query.Hostname)
+}
+
+func TestQueryReaderDelimiterAndCommentsSnapshot(t *testing.T) {
+	t.Parallel()
+	csvContent := "# exported by tool\n" +
+		"hostname;start_time;end_time\n" +
+		"host_000001;2017-01-01 08:59:22;2017-01-01 09:59:22\n" +
+		"# skipped by the csv reader\n" +
+		"host_000002;INVALID TIME HERE;2017-01-02 14:02:02\n"
+
+	options := Options{Delimiter: ';', Comment: '#'}
+	queryReader, err := NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	query, hasMore, err := queryReader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	snaps.MatchSnapshot(t, query.Build())
+
+	// line numbers count the comment lines
+	query, hasMore, err = queryReader.Next()
+	assert.Error(t, err)
+	assert.Empty(t, query)
+	assert.True(t, hasMore)
 	snaps.MatchSnapshot(t, err.Error())
 }
+
+func TestQueryReaderHeaderErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, header := range []string{
+		"host,start,end\n",
+		"hostname,start_time,start_time,end_time\n",
+		"",
+	} {
+		queryReader, err := NewQueryReader(csv.NewReader(strings.NewReader(header)))
+		assert.Error(t, err)
+		assert.Nil(t, queryReader)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestQueryReaderTags(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time,dashboard,tenant\n" +
+		"host_000001,2017-01-01 08:59:22,2017-01-01 09:59:22,ops,A\n" +
+		"host_000002,2017-01-01 08:59:22,2017-01-01 09:59:22,,B\n" +
+		"host_000003,2017-01-01 08:59:22,2017-01-01 09:59:22,,\n"
+
+	options := Options{TagColumns: []string{"dashboard", "tenant"}}
+	queryReader, err := NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	for _, expected := range []map[string]string{
+		{"dashboard": "ops", "tenant": "A"},
+		{"tenant": "B"},
+		nil,
+	} {
+		query, hasMore, err := queryReader.Next()
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+		assert.Equal(t, expected, query.Tags)
+		assert.Nil(t, query.Extra)
+	}
+
+	options = Options{TagColumns: []string{"dashbaord"}}
+	_, err = NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.EqualError(t, err, `missing tag column "dashbaord", got [hostname start_time end_time dashboard tenant]`)
+}
@@ -0,0 +1,81 @@
+package query
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// rejectsHeader are the leading columns of a rejects file, the original record fields follow them
+var rejectsHeader = []string{"line", "reason", "error", "record"}
+
+// RejectsReader is a query Reader that writes every skipped row to a rejects CSV
+// Each rejected row is written as line,reason,error followed by the fields of the original record
+// so data owners can fix the input without reading the benchmark logs
+type RejectsReader struct {
+	reader   Reader
+	writer   *csv.Writer
+	rejected int
+	err      error
+}
+
+// NewRejectsReader creates a new RejectsReader and writes the rejects header
+func NewRejectsReader(reader Reader, writer io.Writer) (*RejectsReader, error) {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(rejectsHeader); err != nil {
+		return nil, fmt.Errorf("error writing rejects header: %w", err)
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return nil, fmt.Errorf("error writing rejects header: %w", err)
+	}
+
+	return &RejectsReader{reader: reader, writer: csvWriter}, nil
+}
+
+// Next reads the next query, errors are written to the rejects file and returned unchanged
+func (r *RejectsReader) Next() (Query, bool, error) {
+	query, hasMore, err := r.reader.Next()
+	if err != nil {
+		r.reject(err)
+	}
+	return query, hasMore, err
+}
+
+// reject writes the row of the error, errors that are not a RowError are written with line 0
+// Rows are flushed one by one so the file is complete even if the benchmark is interrupted
+func (r *RejectsReader) reject(err error) {
+	if r.err != nil {
+		return
+	}
+
+	row := []string{"0", string(ReasonUnknown), err.Error()}
+	var rowErr *RowError
+	if errors.As(err, &rowErr) {
+		row = []string{strconv.Itoa(rowErr.Line), string(rowErr.Reason), err.Error()}
+		row = append(row, rowErr.Record...)
+	}
+
+	if writeErr := r.writer.Write(row); writeErr != nil {
+		r.err = fmt.Errorf("error writing rejected row: %w", writeErr)
+		return
+	}
+	r.writer.Flush()
+	if writeErr := r.writer.Error(); writeErr != nil {
+		r.err = fmt.Errorf("error writing rejected row: %w", writeErr)
+		return
+	}
+	r.rejected++
+}
+
+// Rejected returns the number of rows written to the rejects file
+func (r *RejectsReader) Rejected() int {
+	return r.rejected
+}
+
+// Err returns the first error writing the rejects file, no rows are written after it
+func (r *RejectsReader) Err() error {
+	return r.err
+}
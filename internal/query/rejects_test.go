@@ -0,0 +1,105 @@
+package query
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectsReaderCSVSnapshot(t *testing.T) {
+	t.Parallel()
+	inputFile, err := os.Open("../../resources/invalid_row.csv")
+	assert.NoError(t, err)
+	defer inputFile.Close()
+
+	queryReader, err := NewQueryReader(csv.NewReader(inputFile))
+	assert.NoError(t, err)
+
+	var rejects bytes.Buffer
+	reader, err := NewRejectsReader(queryReader, &rejects)
+	assert.NoError(t, err)
+
+	queries := 0
+	for {
+		_, hasMore, err := reader.Next()
+		if !hasMore {
+			break
+		}
+		if err == nil {
+			queries++
+		}
+	}
+
+	assert.Equal(t, 1, queries)
+	assert.Equal(t, 2, reader.Rejected())
+	assert.NoError(t, reader.Err())
+	snaps.MatchSnapshot(t, rejects.String())
+}
+
+func TestRejectsReaderNDJSONSnapshot(t *testing.T) {
+	t.Parallel()
+	inputFile, err := os.Open("../../resources/query_params.ndjson")
+	assert.NoError(t, err)
+	defer inputFile.Close()
+
+	jsonReader, err := NewJSONReader(inputFile)
+	assert.NoError(t, err)
+
+	var rejects bytes.Buffer
+	reader, err := NewRejectsReader(jsonReader, &rejects)
+	assert.NoError(t, err)
+
+	for {
+		_, hasMore, _ := reader.Next()
+		if !hasMore {
+			break
+		}
+	}
+
+	// the rejected record of a NDJSON line is the line itself
+	records, err := csv.NewReader(&rejects).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, rejectsHeader, records[0])
+	assert.Equal(t, reader.Rejected()+1, len(records))
+	for _, record := range records[1:] {
+		assert.Len(t, record, 4)
+	}
+	snaps.MatchSnapshot(t, records[1:])
+}
+
+type testErrorReader struct {
+	err error
+}
+
+func (r *testErrorReader) Next() (Query, bool, error) {
+	return Query{}, true, r.err
+}
+
+type testFailingWriter struct{}
+
+func (w *testFailingWriter) Write(_ []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestRejectsReaderUnknownError(t *testing.T) {
+	t.Parallel()
+	var rejects bytes.Buffer
+	reader, err := NewRejectsReader(&testErrorReader{err: errors.New("connection reset")}, &rejects)
+	assert.NoError(t, err)
+
+	_, hasMore, err := reader.Next()
+	assert.True(t, hasMore)
+	assert.EqualError(t, err, "connection reset")
+	assert.Equal(t, "line,reason,error,record\n0,unknown,connection reset\n", rejects.String())
+}
+
+func TestRejectsReaderWriteError(t *testing.T) {
+	t.Parallel()
+	_, err := NewRejectsReader(&testErrorReader{}, &testFailingWriter{})
+	assert.EqualError(t, err, "error writing rejects header: disk full")
+}
@@ -0,0 +1,210 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamType is the type a template placeholder is bound as
+type ParamType int
+
+const (
+	// ParamText binds the value as a quoted SQL string literal
+	ParamText ParamType = iota
+	// ParamTimestamp parses the value as a timestamp and binds it as a quoted SQL literal with an UTC offset
+	ParamTimestamp
+	// ParamInt parses the value as a base 10 integer
+	ParamInt
+	// ParamFloat parses the value as a 64 bit float
+	ParamFloat
+)
+
+// String returns the name used for the type in a template placeholder
+func (p ParamType) String() string {
+	switch p {
+	case ParamText:
+		return "text"
+	case ParamTimestamp:
+		return "timestamp"
+	case ParamInt:
+		return "int"
+	case ParamFloat:
+		return "float"
+	default:
+		return fmt.Sprintf("ParamType(%d)", int(p))
+	}
+}
+
+func parseParamType(name string) (ParamType, error) {
+	switch name {
+	case "", "text":
+		return ParamText, nil
+	case "timestamp":
+		return ParamTimestamp, nil
+	case "int":
+		return ParamInt, nil
+	case "float":
+		return ParamFloat, nil
+	default:
+		return 0, fmt.Errorf("unknown param type %q, expected text, timestamp, int or float", name)
+	}
+}
+
+// Param is a named placeholder of a Template
+type Param struct {
+	Name string
+	Type ParamType
+}
+
+// Template is a SQL statement with named placeholders
+// Placeholders are written as {{name}} or {{name:type}}, where type is text (default), timestamp, int or float
+// The name of a placeholder is the name of the CSV column that provides its value
+// For example:
+// SELECT * FROM cpu_usage WHERE host = {{hostname}} AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}}
+type Template struct {
+	// parts are the SQL fragments around the placeholders, len(parts) == len(placeholders)+1
+	parts        []string
+	placeholders []Param
+	params       []Param
+}
+
+// cpuUsageTemplate is the query the benchmark runs when no template is given
+var cpuUsageTemplate = MustParseTemplate(
+	"SELECT * FROM cpu_usage WHERE host = {{hostname}} AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}}")
+
+// ParseTemplate parses a SQL template and validates its placeholders
+func ParseTemplate(sql string) (*Template, error) {
+	template := &Template{}
+	types := make(map[string]ParamType)
+
+	rest := sql
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(rest[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder: %q", rest[start:])
+		}
+		end += start
+
+		name, typeName, _ := strings.Cut(strings.TrimSpace(rest[start+2:end]), ":")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("empty placeholder name: %q", rest[start:end+2])
+		}
+		paramType, err := parseParamType(strings.TrimSpace(typeName))
+		if err != nil {
+			return nil, fmt.Errorf("invalid placeholder %s: %w", name, err)
+		}
+
+		if previous, exists := types[name]; exists {
+			if previous != paramType {
+				return nil, fmt.Errorf("placeholder %s used as %s and %s", name, previous, paramType)
+			}
+		} else {
+			types[name] = paramType
+			template.params = append(template.params, Param{Name: name, Type: paramType})
+		}
+
+		template.parts = append(template.parts, rest[:start])
+		template.placeholders = append(template.placeholders, Param{Name: name, Type: paramType})
+		rest = rest[end+2:]
+	}
+	template.parts = append(template.parts, rest)
+
+	if len(template.params) == 0 {
+		return nil, fmt.Errorf("template has no placeholders")
+	}
+
+	return template, nil
+}
+
+// MustParseTemplate is like ParseTemplate but panics if the template is invalid
+func MustParseTemplate(sql string) *Template {
+	template, err := ParseTemplate(sql)
+	if err != nil {
+		panic(err)
+	}
+	return template
+}
+
+// Params returns the distinct placeholders in order of first appearance
+func (t *Template) Params() []Param {
+	return t.params
+}
+
+// Bind parses the raw values of each placeholder into their typed values, timestamps are parsed with times
+// Values for names that are not placeholders are ignored
+func (t *Template) Bind(values map[string]string, times *TimeParser) (map[string]any, error) {
+	bound := make(map[string]any, len(t.params))
+	for _, param := range t.params {
+		raw, exists := values[param.Name]
+		if !exists {
+			return nil, fmt.Errorf("missing value for %s", param.Name)
+		}
+
+		switch param.Type {
+		case ParamText:
+			bound[param.Name] = raw
+		case ParamTimestamp:
+			value, err := times.Parse(raw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s err: %w", param.Name, raw, err)
+			}
+			bound[param.Name] = value
+		case ParamInt:
+			value, err := strconv.ParseInt(strings.TrimSpace(raw), 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s err: %w", param.Name, raw, err)
+			}
+			bound[param.Name] = value
+		case ParamFloat:
+			value, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s err: %w", param.Name, raw, err)
+			}
+			bound[param.Name] = value
+		}
+	}
+
+	return bound, nil
+}
+
+// Render writes the typed values into the template as SQL literals
+// Values are expected to come from Bind, a missing value is rendered as NULL
+func (t *Template) Render(values map[string]any) string {
+	builder := strings.Builder{}
+	for i, placeholder := range t.placeholders {
+		builder.WriteString(t.parts[i])
+		builder.WriteString(literal(values[placeholder.Name]))
+	}
+	builder.WriteString(t.parts[len(t.parts)-1])
+	return builder.String()
+}
+
+// literal formats a bound value as a SQL literal, strings are quoted and escaped
+// A list of strings is rendered as a comma separated list of literals, e.g. for IN (...)
+func literal(value any) string {
+	switch v := value.(type) {
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case []string:
+		literals := make([]string, len(v))
+		for i, s := range v {
+			literals[i] = literal(s)
+		}
+		return strings.Join(literals, ", ")
+	case time.Time:
+		return "'" + v.UTC().Format(sqlTimeLayout) + "'"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return "NULL"
+	}
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"encoding/csv"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+func TestParseTemplate(t *testing.T) {
+	t.Parallel()
+	template, err := ParseTemplate("SELECT * FROM t WHERE a = {{a}} AND b > {{ b:int }} AND c < {{c:float}} AND a <> {{a:text}}")
+	assert.NoError(t, err)
+	assert.Equal(t, []Param{
+		{Name: "a", Type: ParamText},
+		{Name: "b", Type: ParamInt},
+		{Name: "c", Type: ParamFloat},
+	}, template.Params())
+}
+
+func TestParseTemplateErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, sql := range []string{
+		"SELECT 1",
+		"SELECT {{a",
+		"SELECT {{}}",
+		"SELECT {{a:bool}}",
+		"SELECT {{a:int}}, {{a:float}}",
+	} {
+		template, err := ParseTemplate(sql)
+		assert.Error(t, err)
+		assert.Nil(t, template)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestTemplateRenderSnapshot(t *testing.T) {
+	t.Parallel()
+	content, err := os.ReadFile("../../resources/high_cpu_template.sql")
+	assert.NoError(t, err)
+	template, err := ParseTemplate(string(content))
+	assert.NoError(t, err)
+
+	params, err := template.Bind(map[string]string{
+		"hostname":   "host_'1",
+		"start_time": "2025-01-01 00:00:00",
+		"end_time":   "2025-01-01 00:00:01",
+		"threshold":  "90.5",
+		"limit":      "10",
+		"ignored":    "value",
+	}, DefaultTimeParser)
+	assert.NoError(t, err)
+	snaps.MatchSnapshot(t, template.Render(params))
+}
+
+func TestTemplateBindErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	template := MustParseTemplate("SELECT {{ts:timestamp}}, {{n:int}}, {{f:float}}")
+	for _, values := range []map[string]string{
+		{"ts": "yesterday", "n": "1", "f": "1"},
+		{"ts": "2025-01-01 00:00:00", "n": "1.5", "f": "1"},
+		{"ts": "2025-01-01 00:00:00", "n": "1", "f": "one"},
+		{"ts": "2025-01-01 00:00:00", "n": "1"},
+	} {
+		params, err := template.Bind(values, DefaultTimeParser)
+		assert.Error(t, err)
+		assert.Nil(t, params)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+// The default query is a template too, rendering it with the Query fields must match Build
+func TestDefaultTemplateMatchesBuildProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		hostname := rapid.StringMatching(`host_[0-9]{6}`).Draw(t, "hostname")
+		startTime := time.Unix(rapid.Int64Range(0, 2_000_000_000).Draw(t, "start"), 0).UTC()
+		endTime := startTime.Add(time.Duration(rapid.IntRange(0, 86_400).Draw(t, "window")) * time.Second)
+
+		csvContent := "hostname,start_time,end_time\n" +
+			hostname + "," + startTime.Format(timeLayout) + "," + endTime.Format(timeLayout) + "\n"
+		reader, err := NewTemplateReader(csv.NewReader(strings.NewReader(csvContent)), cpuUsageTemplate)
+		assert.NoError(t, err)
+
+		templateQuery, hasMore, err := reader.Next()
+		assert.NoError(t, err)
+		assert.True(t, hasMore)
+
+		query := Query{Hostname: hostname, StartTime: startTime, EndTime: endTime}
+		assert.Equal(t, query.Build(), templateQuery.Build())
+		assert.Equal(t, query.Hostname, templateQuery.Hostname)
+		assert.Equal(t, query.StartTime, templateQuery.StartTime)
+		assert.Equal(t, query.EndTime, templateQuery.EndTime)
+	})
+}
+
+func TestTemplateReaderSnapshot(t *testing.T) {
+	t.Parallel()
+	content, err := os.ReadFile("../../resources/high_cpu_template.sql")
+	assert.NoError(t, err)
+	template, err := ParseTemplate(string(content))
+	assert.NoError(t, err)
+
+	inputFile, err := os.Open("../../resources/high_cpu_params.csv")
+	assert.NoError(t, err)
+	defer inputFile.Close()
+
+	reader, err := NewTemplateReader(csv.NewReader(inputFile), template)
+	assert.NoError(t, err)
+
+	// line 2: valid
+	query, hasMore, err := reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, "host_000008", query.Hostname)
+	snaps.MatchSnapshot(t, query.Build())
+
+	// line 3: valid
+	query, hasMore, err = reader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	snaps.MatchSnapshot(t, query.Build())
+
+	// line 4: invalid threshold
+	query, hasMore, err = reader.Next()
+	assert.Error(t, err)
+	assert.Empty(t, query)
+	assert.True(t, hasMore)
+	snaps.MatchSnapshot(t, err.Error())
+
+	// EOF
+	_, hasMore, err = reader.Next()
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+}
+
+func TestTemplateReaderMissingColumnsSnapshot(t *testing.T) {
+	t.Parallel()
+	inputFile, err := os.Open("../../resources/query_params.csv")
+	assert.NoError(t, err)
+	defer inputFile.Close()
+
+	template := MustParseTemplate("SELECT * FROM cpu_usage WHERE host = {{hostname}} AND usage > {{threshold:float}} LIMIT {{limit:int}}")
+	reader, err := NewTemplateReader(csv.NewReader(inputFile), template)
+	assert.Error(t, err)
+	assert.Nil(t, reader)
+	snaps.MatchSnapshot(t, err.Error())
+}
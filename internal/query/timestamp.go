@@ -0,0 +1,116 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FormatDateTime is the default format, e.g. 2017-01-01 08:59:22, fractional seconds are accepted
+	FormatDateTime = "datetime"
+	// FormatRFC3339 is RFC3339 with an optional fractional second, e.g. 2017-01-01T08:59:22.5+01:00
+	FormatRFC3339 = "rfc3339"
+	// FormatUnix is seconds since the Unix epoch, with an optional fractional part, e.g. 1483261162
+	FormatUnix = "unix"
+	// FormatUnixMilli is milliseconds since the Unix epoch, e.g. 1483261162000
+	FormatUnixMilli = "unix_ms"
+)
+
+// sqlTimeLayout is how timestamps are written into the SQL, with an explicit offset so TIMESTAMPTZ
+// predicates do not depend on the session time zone
+const sqlTimeLayout = "2006-01-02 15:04:05.999999-07:00"
+
+// DefaultTimeParser parses the datetime format in UTC, the format of resources/query_params.csv
+var DefaultTimeParser = &TimeParser{formats: []string{FormatDateTime}, location: time.UTC}
+
+// TimeParser parses timestamps trying each format in order
+// Formats are one of the named formats above or a Go time layout
+// Timestamps without an offset are read in the parser location
+type TimeParser struct {
+	formats  []string
+	location *time.Location
+}
+
+// NewTimeParser creates a new TimeParser, defaults to the datetime format in UTC
+func NewTimeParser(formats []string, location *time.Location) (*TimeParser, error) {
+	if len(formats) == 0 {
+		formats = []string{FormatDateTime}
+	}
+	if location == nil {
+		location = time.UTC
+	}
+
+	for _, format := range formats {
+		if strings.TrimSpace(format) == "" {
+			return nil, fmt.Errorf("empty time format in %v", formats)
+		}
+	}
+
+	return &TimeParser{formats: formats, location: location}, nil
+}
+
+// Parse parses the value with the first format that matches
+// With a single format the error is the error of that format
+func (p *TimeParser) Parse(value string) (time.Time, error) {
+	var firstErr error
+	for _, format := range p.formats {
+		parsed, err := p.parse(format, value)
+		if err == nil {
+			return parsed, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if len(p.formats) == 1 {
+		return time.Time{}, firstErr
+	}
+	return time.Time{}, fmt.Errorf("parsing time %q: does not match any of the formats %v", value, p.formats)
+}
+
+func (p *TimeParser) parse(format, value string) (time.Time, error) {
+	switch format {
+	case FormatDateTime:
+		return time.ParseInLocation(timeLayout, value, p.location)
+	case FormatRFC3339:
+		return time.Parse(time.RFC3339Nano, value)
+	case FormatUnix:
+		return parseUnix(value)
+	case FormatUnixMilli:
+		millis, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing time %q as unix milliseconds: %w", value, err)
+		}
+		return time.UnixMilli(millis).UTC(), nil
+	default:
+		return time.ParseInLocation(format, value, p.location)
+	}
+}
+
+// parseUnix parses seconds since the epoch with an optional fractional part up to nanoseconds
+func parseUnix(value string) (time.Time, error) {
+	rawSeconds, rawFraction, hasFraction := strings.Cut(strings.TrimSpace(value), ".")
+	seconds, err := strconv.ParseInt(rawSeconds, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing time %q as unix seconds: %w", value, err)
+	}
+
+	var nanos int64
+	if hasFraction {
+		if len(rawFraction) == 0 || len(rawFraction) > 9 {
+			return time.Time{}, fmt.Errorf("parsing time %q as unix seconds: invalid fractional seconds", value)
+		}
+		nanos, err = strconv.ParseInt(rawFraction+strings.Repeat("0", 9-len(rawFraction)), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing time %q as unix seconds: %w", value, err)
+		}
+		if seconds < 0 || strings.HasPrefix(rawSeconds, "-") {
+			nanos = -nanos
+		}
+	}
+
+	return time.Unix(seconds, nanos).UTC(), nil
+}
@@ -0,0 +1,104 @@
+package query
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"pgregory.net/rapid"
+)
+
+func TestTimeParserFormats(t *testing.T) {
+	t.Parallel()
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	expected := time.Date(2017, 1, 1, 8, 59, 22, 500_000_000, time.UTC)
+	for _, testCase := range []struct {
+		formats  []string
+		location *time.Location
+		value    string
+	}{
+		{formats: []string{FormatDateTime}, value: "2017-01-01 08:59:22.5"},
+		{formats: []string{FormatDateTime}, location: newYork, value: "2017-01-01 03:59:22.5"},
+		{formats: []string{FormatRFC3339}, value: "2017-01-01T08:59:22.5Z"},
+		{formats: []string{FormatRFC3339}, value: "2017-01-01T09:59:22.5+01:00"},
+		{formats: []string{FormatUnix}, value: "1483261162.5"},
+		{formats: []string{FormatUnixMilli}, value: "1483261162500"},
+		{formats: []string{"02/01/2006 15:04:05.000"}, value: "01/01/2017 08:59:22.500"},
+		{formats: []string{FormatUnix, FormatRFC3339}, value: "2017-01-01T08:59:22.5Z"},
+	} {
+		parser, err := NewTimeParser(testCase.formats, testCase.location)
+		assert.NoError(t, err)
+
+		parsed, err := parser.Parse(testCase.value)
+		assert.NoError(t, err, testCase.value)
+		assert.True(t, expected.Equal(parsed), "%s parsed as %s", testCase.value, parsed)
+	}
+}
+
+func TestTimeParserErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, formats := range [][]string{
+		{FormatUnix},
+		{FormatUnixMilli},
+		{FormatRFC3339},
+		{FormatUnix, FormatRFC3339, FormatDateTime},
+	} {
+		parser, err := NewTimeParser(formats, nil)
+		assert.NoError(t, err)
+
+		parsed, err := parser.Parse("2017-01-01 08:59:22 PST")
+		assert.Error(t, err)
+		assert.True(t, parsed.IsZero())
+		snaps.MatchSnapshot(t, err.Error())
+	}
+
+	parser, err := NewTimeParser([]string{FormatUnix, " "}, nil)
+	assert.Error(t, err)
+	assert.Nil(t, parser)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func TestTimeParserUnixProperties(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		expected := time.UnixMilli(rapid.Int64Range(-2_000_000_000_000, 4_000_000_000_000).Draw(t, "millis")).UTC()
+
+		parser, err := NewTimeParser([]string{FormatUnix, FormatUnixMilli}, nil)
+		assert.NoError(t, err)
+
+		millis, err := parser.Parse(strconv.FormatInt(expected.UnixMilli(), 10))
+		assert.NoError(t, err)
+		// unix is tried first, big values are valid seconds too
+		assert.Equal(t, time.Unix(expected.UnixMilli(), 0).UTC(), millis)
+
+		parser, err = NewTimeParser([]string{FormatUnixMilli}, nil)
+		assert.NoError(t, err)
+		millis, err = parser.Parse(strconv.FormatInt(expected.UnixMilli(), 10))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, millis)
+	})
+}
+
+// Timestamps are always written with an offset, the default time zone only changes how they are read
+func TestQueryReaderTimeZoneSnapshot(t *testing.T) {
+	t.Parallel()
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	csvContent := "hostname,start_time,end_time\n" +
+		"host_000001,2017-01-01 03:59:22,2017-01-01T09:59:22.123456+00:00\n"
+	options := Options{TimeFormats: []string{FormatDateTime, FormatRFC3339}, Location: newYork}
+	queryReader, err := NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	query, hasMore, err := queryReader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	snaps.MatchSnapshot(t, query.Build())
+}
@@ -0,0 +1,106 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Reason is a machine readable code describing why a row was skipped
+type Reason string
+
+const (
+	// ReasonUnknown is used for errors that are not a RowError
+	ReasonUnknown Reason = "unknown"
+	// ReasonMalformedRow is a row that can not be read, e.g. wrong number of fields
+	ReasonMalformedRow Reason = "malformed_row"
+	// ReasonInvalidValue is a value that can not be parsed as its type, e.g. a timestamp
+	ReasonInvalidValue Reason = "invalid_value"
+	// ReasonInvalidHostname is a hostname not matching Validation.HostnamePattern
+	ReasonInvalidHostname Reason = "invalid_hostname"
+	// ReasonStartAfterEnd is a row where start_time is after end_time
+	ReasonStartAfterEnd Reason = "start_after_end"
+	// ReasonWindowTooLong is a row where end_time - start_time is longer than Validation.MaxWindow
+	ReasonWindowTooLong Reason = "window_too_long"
+	// ReasonOutOfBounds is a row with timestamps outside of Validation.MinTime and Validation.MaxTime
+	ReasonOutOfBounds Reason = "out_of_bounds"
+	// ReasonInvalidSource is an input source that can not be opened or has an invalid header, see MultiReader
+	ReasonInvalidSource Reason = "invalid_source"
+)
+
+// RowError is the error returned by a Reader when a row is skipped
+// The message is the message of Err, Line, Reason and Record describe the skipped row
+// Source is the name of the input the row was read from, only set when reading several inputs
+type RowError struct {
+	Source string
+	Line   int
+	Reason Reason
+	Record []string
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	if e.Source != "" {
+		return e.Source + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// ReasonOf returns the reason of a RowError, or ReasonUnknown for any other error
+func ReasonOf(err error) Reason {
+	var rowErr *RowError
+	if errors.As(err, &rowErr) {
+		return rowErr.Reason
+	}
+	return ReasonUnknown
+}
+
+// Validation are the semantic checks applied to every row after parsing
+// The zero value checks nothing, every rule is enabled on its own
+type Validation struct {
+	// HostnamePattern must match the hostname, anchor it with ^ and $ to match the whole hostname
+	HostnamePattern *regexp.Regexp
+	// StartBeforeEnd rejects rows where start_time is after end_time
+	StartBeforeEnd bool
+	// MaxWindow is the longest allowed end_time - start_time, disabled when 0
+	MaxWindow time.Duration
+	// MinTime and MaxTime are the bounds of the dataset, both timestamps must be within them. Disabled when zero
+	MinTime time.Time
+	MaxTime time.Time
+}
+
+// Validate checks the query against every enabled rule and returns the reason of the first failure
+// Time rules are only checked when the query has both timestamps, template queries may not have them
+func (v Validation) Validate(query Query) (Reason, error) {
+	if v.HostnamePattern != nil && !v.HostnamePattern.MatchString(query.Hostname) {
+		return ReasonInvalidHostname, fmt.Errorf("invalid hostname: %s does not match %s", query.Hostname, v.HostnamePattern)
+	}
+
+	if query.StartTime.IsZero() || query.EndTime.IsZero() {
+		return "", nil
+	}
+
+	if v.StartBeforeEnd && query.StartTime.After(query.EndTime) {
+		return ReasonStartAfterEnd, fmt.Errorf("invalid time range: start_time %s is after end_time %s",
+			query.StartTime.Format(time.RFC3339Nano), query.EndTime.Format(time.RFC3339Nano))
+	}
+
+	if window := query.EndTime.Sub(query.StartTime); v.MaxWindow > 0 && window > v.MaxWindow {
+		return ReasonWindowTooLong, fmt.Errorf("invalid time range: window %v is longer than %v", window, v.MaxWindow)
+	}
+
+	if !v.MinTime.IsZero() && (query.StartTime.Before(v.MinTime) || query.EndTime.Before(v.MinTime)) {
+		return ReasonOutOfBounds, fmt.Errorf("invalid time range: before dataset start %s", v.MinTime.Format(time.RFC3339Nano))
+	}
+
+	if !v.MaxTime.IsZero() && (query.StartTime.After(v.MaxTime) || query.EndTime.After(v.MaxTime)) {
+		return ReasonOutOfBounds, fmt.Errorf("invalid time range: after dataset end %s", v.MaxTime.Format(time.RFC3339Nano))
+	}
+
+	return "", nil
+}
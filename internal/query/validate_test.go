@@ -0,0 +1,84 @@
+package query
+
+import (
+	"encoding/csv"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidationZeroValueAcceptsEverything(t *testing.T) {
+	t.Parallel()
+	query := Query{
+		Hostname:  "not a hostname",
+		StartTime: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndTime:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	reason, err := Validation{}.Validate(query)
+	assert.NoError(t, err)
+	assert.Empty(t, reason)
+}
+
+func TestQueryReaderValidationSnapshot(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time\n" +
+		"host_000001,2017-01-01 08:59:22,2017-01-01 09:59:22\n" +
+		"HOST-1,2017-01-01 08:59:22,2017-01-01 09:59:22\n" +
+		"host_000002,2017-01-01 09:59:22,2017-01-01 08:59:22\n" +
+		"host_000003,2017-01-01 08:59:22,2017-01-03 08:59:22\n" +
+		"host_000004,2016-12-31 23:59:59,2017-01-01 00:59:59\n" +
+		"host_000005,2017-01-03 23:30:00,2017-01-04 00:30:00\n" +
+		"host_000006,2017-01-01 08:59:22,INVALID\n"
+
+	options := Options{
+		Validation: Validation{
+			HostnamePattern: regexp.MustCompile(`^host_[0-9]{6}$`),
+			StartBeforeEnd:  true,
+			MaxWindow:       24 * time.Hour,
+			MinTime:         time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			MaxTime:         time.Date(2017, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	queryReader, err := NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	query, hasMore, err := queryReader.Next()
+	assert.NoError(t, err)
+	assert.True(t, hasMore)
+	assert.Equal(t, "host_000001", query.Hostname)
+
+	for line, expected := range []Reason{
+		ReasonInvalidHostname,
+		ReasonStartAfterEnd,
+		ReasonWindowTooLong,
+		ReasonOutOfBounds,
+		ReasonOutOfBounds,
+		ReasonInvalidValue,
+	} {
+		query, hasMore, err := queryReader.Next()
+		assert.Error(t, err)
+		assert.Empty(t, query)
+		assert.True(t, hasMore)
+		assert.Equal(t, expected, ReasonOf(err))
+
+		var rowErr *RowError
+		assert.True(t, errors.As(err, &rowErr))
+		assert.Equal(t, line+3, rowErr.Line)
+		assert.Len(t, rowErr.Record, 3)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+
+	_, hasMore, err = queryReader.Next()
+	assert.NoError(t, err)
+	assert.False(t, hasMore)
+}
+
+func TestReasonOfUnknownError(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, ReasonUnknown, ReasonOf(errors.New("not a row error")))
+}
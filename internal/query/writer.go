@@ -0,0 +1,48 @@
+package query
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+)
+
+// writeTimeLayout is timeLayout with an optional fractional second, it is read back by the datetime format
+const writeTimeLayout = "2006-01-02 15:04:05.999999999"
+
+// CSVWriter writes queries in the input CSV format, so they can be read back with a CSVReader
+// Timestamps are written in UTC in the default datetime format, with fractional seconds when they have them
+type CSVWriter struct {
+	writer *csv.Writer
+	extra  []string
+}
+
+// NewCSVWriter creates a new CSVWriter and writes the header
+// extra are the names of Query.Extra values written after the required columns
+func NewCSVWriter(writer io.Writer, extra ...string) (*CSVWriter, error) {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(append(append([]string{}, requiredColumns...), extra...)); err != nil {
+		return nil, fmt.Errorf("error writing headers: %w", err)
+	}
+
+	return &CSVWriter{writer: csvWriter, extra: extra}, nil
+}
+
+// Write writes the query as a CSV record, missing extra values are written empty
+func (w *CSVWriter) Write(query Query) error {
+	record := []string{
+		query.Hostname,
+		query.StartTime.UTC().Format(writeTimeLayout),
+		query.EndTime.UTC().Format(writeTimeLayout),
+	}
+	for _, name := range w.extra {
+		record = append(record, query.Extra[name])
+	}
+
+	return w.writer.Write(record)
+}
+
+// Flush writes any buffered records to the underlying writer
+func (w *CSVWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
@@ -0,0 +1,249 @@
+package ramp
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/metrics"
+	"github.com/vrnvu/go-sql/internal/query"
+	"github.com/vrnvu/go-sql/internal/workerpool"
+)
+
+// Mode is what a Ramp raises at each step
+type Mode string
+
+const (
+	// ModeWorkers raises the number of workers, closed loop
+	ModeWorkers Mode = "workers"
+	// ModeRate raises the target rate with a fixed number of workers, open loop, see workerpool.Options.TargetRate
+	ModeRate Mode = "rate"
+)
+
+const (
+	// minEfficiency is the share of the added load a step must turn into throughput, e.g. doubling the workers
+	// must add at least 50% throughput. Below it throughput has flattened
+	minEfficiency = 0.5
+	// minLatencyGrowth is the growth of the p99 latency over the previous step that counts as latency climbing
+	minLatencyGrowth = 0.25
+)
+
+// Spec is a stepped load: each value of Steps is held for Hold
+type Spec struct {
+	Mode  Mode
+	Steps []float64
+	Hold  time.Duration
+}
+
+// ParseSpec parses mode=value,value,... e.g. workers=8,16,32,64 or rate=100,200,400
+// Steps must increase, workers must be integers between 1 and workerpool.MaxWorkers
+func ParseSpec(value string, hold time.Duration) (Spec, error) {
+	mode, rawSteps, found := strings.Cut(value, "=")
+	if !found {
+		return Spec{}, fmt.Errorf("invalid ramp %q: expected workers=n,n,... or rate=n,n,...", value)
+	}
+
+	spec := Spec{Mode: Mode(mode), Hold: hold}
+	if spec.Mode != ModeWorkers && spec.Mode != ModeRate {
+		return Spec{}, fmt.Errorf("invalid ramp: unknown mode %q, expected workers or rate", mode)
+	}
+	if hold <= 0 {
+		return Spec{}, fmt.Errorf("invalid ramp: hold %v must be greater than 0", hold)
+	}
+
+	for _, rawStep := range strings.Split(rawSteps, ",") {
+		step, err := strconv.ParseFloat(strings.TrimSpace(rawStep), 64)
+		if err != nil || step <= 0 {
+			return Spec{}, fmt.Errorf("invalid ramp: step %q must be a number greater than 0", rawStep)
+		}
+		if spec.Mode == ModeWorkers && (step != math.Trunc(step) || step > workerpool.MaxWorkers) {
+			return Spec{}, fmt.Errorf("invalid ramp: workers %q must be an integer less than %d", rawStep, workerpool.MaxWorkers)
+		}
+		if len(spec.Steps) > 0 && step <= spec.Steps[len(spec.Steps)-1] {
+			return Spec{}, fmt.Errorf("invalid ramp: steps must increase, got %v after %v", step, spec.Steps[len(spec.Steps)-1])
+		}
+		spec.Steps = append(spec.Steps, step)
+	}
+
+	return spec, nil
+}
+
+// MaxWorkers is the number of workers of the largest step, the connection pool must hold as many
+func (s Spec) MaxWorkers(workers int) int {
+	if s.Mode == ModeWorkers {
+		return int(s.Steps[len(s.Steps)-1])
+	}
+	return workers
+}
+
+// Duration is the time the steps are held, the run takes longer while the last queries of each step finish
+func (s Spec) Duration() time.Duration {
+	return time.Duration(len(s.Steps)) * s.Hold
+}
+
+// Run runs every step of the spec one after the other, reading the queries of all steps from reader
+// workers is the number of workers of ModeRate steps, options are the options of every step
+// A step that fails stops the ramp, the report holds the steps run so far. The ramp also stops when the input ends
+func Run(ctx context.Context, spec Spec, client client.Client, reader query.Reader, workers int, options workerpool.Options) (Report, error) {
+	report := Report{Mode: spec.Mode, Hold: spec.Hold}
+
+	for i, value := range spec.Steps {
+		step := StepReport{Step: i + 1, Workers: workers}
+		if spec.Mode == ModeWorkers {
+			step.Workers = int(value)
+		} else {
+			step.Rate = value
+			options.TargetRate = value
+		}
+		log.Printf("ramp: step %d of %d, %s %v for %v", step.Step, len(spec.Steps), spec.Mode, value, spec.Hold)
+
+		slots := make(chan struct{}, step.Workers)
+		stepReader := &holdReader{reader: reader, deadline: time.Now().Add(spec.Hold), slots: slots}
+		// the pool frees the slot of every query it is done with, including the queries dropped when a run aborts
+		options.OnDone = func() {
+			<-slots
+		}
+		wp, err := workerpool.NewWithOptions(step.Workers, client, stepReader, options)
+		if err != nil {
+			return report, err
+		}
+
+		start := time.Now()
+		step.Result, err = wp.Run(ctx)
+		step.WallTime = time.Since(start)
+		report.Steps = append(report.Steps, step)
+		if err != nil {
+			return report, fmt.Errorf("step %d: %w", step.Step, err)
+		}
+		if stepReader.ended {
+			log.Printf("ramp: input ended at step %d", step.Step)
+			break
+		}
+	}
+
+	return report, nil
+}
+
+// holdReader reads queries until the deadline, so a step is held for its duration
+// It does not read past the deadline, the next query is left for the next step
+// It reads a query only when a worker slot is free, otherwise the pool fills the worker queues
+// and the queries queued at the deadline run after it
+type holdReader struct {
+	reader   query.Reader
+	deadline time.Time
+	slots    chan struct{}
+	ended    bool
+}
+
+func (r *holdReader) Next() (query.Query, bool, error) {
+	if !time.Now().Before(r.deadline) {
+		return query.Query{}, false, nil
+	}
+	r.slots <- struct{}{}
+
+	q, hasMore, err := r.reader.Next()
+	if !hasMore {
+		r.ended = true
+	}
+	// skipped rows and the end of the input never reach the workers
+	if err != nil || !hasMore {
+		<-r.slots
+	}
+	return q, hasMore, err
+}
+
+// StepReport is the result of a single step
+type StepReport struct {
+	Step     int
+	Workers  int
+	Rate     float64
+	WallTime time.Duration
+	Result   metrics.Result
+}
+
+// Throughput is the number of successful queries per second of wall time
+func (s StepReport) Throughput() float64 {
+	if s.WallTime <= 0 {
+		return 0
+	}
+	return float64(s.Result.NumberOfQueries) / s.WallTime.Seconds()
+}
+
+// load is the value the ramp raises at the step
+func (s StepReport) load(mode Mode) float64 {
+	if mode == ModeWorkers {
+		return float64(s.Workers)
+	}
+	return s.Rate
+}
+
+// p99 is the p99 latency of the step, corrected from the intended start when the step has a target rate
+func (s StepReport) p99() time.Duration {
+	if s.Result.Corrected != nil {
+		return s.Result.Corrected.P99Response
+	}
+	return s.Result.P99Response
+}
+
+// Report is the result of every step of a ramp
+type Report struct {
+	Mode  Mode
+	Hold  time.Duration
+	Steps []StepReport
+}
+
+// Saturation returns the first step where throughput flattens and latency climbs, false when no step saturates
+// Throughput flattens when less than minEfficiency of the added load turns into throughput,
+// latency climbs when the p99 grows more than minLatencyGrowth over the previous step
+func (r *Report) Saturation() (StepReport, bool) {
+	for i := 1; i < len(r.Steps); i++ {
+		previous, current := r.Steps[i-1], r.Steps[i]
+		if previous.Throughput() == 0 || previous.p99() == 0 {
+			continue
+		}
+
+		loadGrowth := current.load(r.Mode)/previous.load(r.Mode) - 1
+		throughputGrowth := current.Throughput()/previous.Throughput() - 1
+		latencyGrowth := float64(current.p99())/float64(previous.p99()) - 1
+		if throughputGrowth < minEfficiency*loadGrowth && latencyGrowth > minLatencyGrowth {
+			return current, true
+		}
+	}
+	return StepReport{}, false
+}
+
+// Table prints a line per step with throughput and latency percentiles, then the saturation point
+func (r *Report) Table() string {
+	builder := strings.Builder{}
+	builder.WriteString("\n\n=====================\n")
+	builder.WriteString(fmt.Sprintf("Ramp: %s, %v per step\n", r.Mode, r.Hold))
+	builder.WriteString("=====================\n")
+	for _, step := range r.Steps {
+		builder.WriteString(fmt.Sprintf("step %d: workers %d", step.Step, step.Workers))
+		if step.Rate > 0 {
+			builder.WriteString(fmt.Sprintf(", rate %v", step.Rate))
+		}
+		builder.WriteString(fmt.Sprintf(", queries %d, failed %d, throughput %.2f qps, median %v, p90 %v, p95 %v, p99 %v, max %v",
+			step.Result.NumberOfQueries, step.Result.FailedQueries, step.Throughput(),
+			step.Result.MedianResponse, step.Result.P90Response, step.Result.P95Response, step.Result.P99Response, step.Result.MaxResponse))
+		if step.Result.Corrected != nil {
+			builder.WriteString(fmt.Sprintf(", corrected p99 %v", step.Result.Corrected.P99Response))
+		}
+		builder.WriteString("\n")
+	}
+
+	if saturated, found := r.Saturation(); found {
+		previous := r.Steps[saturated.Step-2]
+		builder.WriteString(fmt.Sprintf("\nSaturation: step %d, throughput %+.1f%% and p99 %+.1f%% over step %d\n",
+			saturated.Step, (saturated.Throughput()/previous.Throughput()-1)*100,
+			(float64(saturated.p99())/float64(previous.p99())-1)*100, previous.Step))
+	} else {
+		builder.WriteString("\nSaturation: not reached\n")
+	}
+	return builder.String()
+}
@@ -0,0 +1,201 @@
+package ramp
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/metrics"
+	"github.com/vrnvu/go-sql/internal/query"
+	"github.com/vrnvu/go-sql/internal/workerpool"
+)
+
+// testSaturatedClient runs at most slots queries at once, each takes delay, like a database with a few cores
+// The response duration includes the wait for a free slot
+type testSaturatedClient struct {
+	slots chan struct{}
+	delay time.Duration
+}
+
+func newTestSaturatedClient(slots int, delay time.Duration) *testSaturatedClient {
+	return &testSaturatedClient{slots: make(chan struct{}, slots), delay: delay}
+}
+
+func (t *testSaturatedClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testSaturatedClient) Query(_ context.Context, _ string) (*client.Response, error) {
+	start := time.Now()
+	t.slots <- struct{}{}
+	time.Sleep(t.delay)
+	<-t.slots
+	return &client.Response{Duration: time.Since(start)}, nil
+}
+
+// testEndlessReader reads queries for a few hosts forever
+type testEndlessReader struct {
+	read int
+}
+
+func (t *testEndlessReader) Next() (query.Query, bool, error) {
+	t.read++
+	startTime := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	return query.Query{Hostname: fmt.Sprintf("host_%06d", t.read%16), StartTime: startTime, EndTime: startTime.Add(time.Hour)}, true, nil
+}
+
+func TestParseSpec(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseSpec("workers=8,16, 32", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, Spec{Mode: ModeWorkers, Steps: []float64{8, 16, 32}, Hold: time.Minute}, spec)
+	assert.Equal(t, 32, spec.MaxWorkers(4))
+	assert.Equal(t, 3*time.Minute, spec.Duration())
+
+	spec, err = ParseSpec("rate=100,250.5", time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{100, 250.5}, spec.Steps)
+	assert.Equal(t, 4, spec.MaxWorkers(4))
+}
+
+func TestParseSpecErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, value := range []string{"8,16,32", "threads=8", "workers=8,x", "workers=0", "workers=1.5", "workers=2000", "rate=100,50", "rate=100,100"} {
+		_, err := ParseSpec(value, time.Second)
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+	_, err := ParseSpec("workers=8", 0)
+	assert.Error(t, err)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func testStep(step, workers int, queries int, p99 time.Duration) StepReport {
+	return StepReport{
+		Step:     step,
+		Workers:  workers,
+		WallTime: time.Second,
+		Result: metrics.Result{
+			NumberOfQueries: queries,
+			MedianResponse:  p99 / 2,
+			P90Response:     p99 * 3 / 4,
+			P95Response:     p99 * 9 / 10,
+			P99Response:     p99,
+			MaxResponse:     p99 * 2,
+		},
+	}
+}
+
+func TestSaturation(t *testing.T) {
+	t.Parallel()
+	report := Report{Mode: ModeWorkers, Hold: time.Second, Steps: []StepReport{
+		testStep(1, 8, 800, 10*time.Millisecond),
+		testStep(2, 16, 1500, 11*time.Millisecond),
+		// throughput still grows, but latency is flat
+		testStep(3, 32, 2000, 12*time.Millisecond),
+		// throughput flattens and latency climbs
+		testStep(4, 64, 2100, 30*time.Millisecond),
+		testStep(5, 128, 2000, 70*time.Millisecond),
+	}}
+
+	saturated, found := report.Saturation()
+	assert.True(t, found)
+	assert.Equal(t, 4, saturated.Step)
+	snaps.MatchSnapshot(t, report.Table())
+
+	report.Steps = report.Steps[:3]
+	_, found = report.Saturation()
+	assert.False(t, found)
+	snaps.MatchSnapshot(t, report.Table())
+}
+
+func TestSaturationUsesCorrectedLatency(t *testing.T) {
+	t.Parallel()
+	first, second := testStep(1, 4, 100, 10*time.Millisecond), testStep(2, 4, 110, 10*time.Millisecond)
+	first.Rate, second.Rate = 100, 200
+	// the service time is flat, but queries wait longer and longer for a worker
+	first.Result.Corrected = &metrics.Result{P99Response: 10 * time.Millisecond}
+	second.Result.Corrected = &metrics.Result{P99Response: 500 * time.Millisecond}
+
+	report := Report{Mode: ModeRate, Hold: time.Second, Steps: []StepReport{first, second}}
+	saturated, found := report.Saturation()
+	assert.True(t, found)
+	assert.Equal(t, 2, saturated.Step)
+}
+
+func TestRunFindsSaturation(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseSpec("workers=1,2,8", 200*time.Millisecond)
+	assert.NoError(t, err)
+
+	// the client runs 2 queries at once, more than 2 workers only queue
+	report, err := Run(context.Background(), spec, newTestSaturatedClient(2, 10*time.Millisecond), &testEndlessReader{}, 0, workerpool.Options{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Steps, 3)
+	for i, workers := range []int{1, 2, 8} {
+		assert.Equal(t, workers, report.Steps[i].Workers)
+		assert.Greater(t, report.Steps[i].Result.NumberOfQueries, 0)
+		assert.GreaterOrEqual(t, report.Steps[i].WallTime, 200*time.Millisecond)
+	}
+
+	saturated, found := report.Saturation()
+	assert.True(t, found, report.Table())
+	assert.Equal(t, 3, saturated.Step)
+}
+
+func TestRunRate(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseSpec("rate=50,100", 100*time.Millisecond)
+	assert.NoError(t, err)
+
+	report, err := Run(context.Background(), spec, newTestSaturatedClient(4, time.Millisecond), &testEndlessReader{}, 2, workerpool.Options{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Steps, 2)
+	assert.Equal(t, 2, report.Steps[1].Workers)
+	assert.Equal(t, 100.0, report.Steps[1].Rate)
+	// 100ms at 100 queries per second
+	assert.InDelta(t, 10, report.Steps[1].Result.NumberOfQueries, 1)
+	assert.NotNil(t, report.Steps[1].Result.Corrected)
+}
+
+func TestRunStopsWhenInputEnds(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseSpec("workers=1,2,4", time.Minute)
+	assert.NoError(t, err)
+
+	reader, err := query.NewLimitReader(&testEndlessReader{}, 10)
+	assert.NoError(t, err)
+	report, err := Run(context.Background(), spec, newTestSaturatedClient(4, time.Millisecond), reader, 0, workerpool.Options{})
+	assert.NoError(t, err)
+	assert.Len(t, report.Steps, 1)
+	assert.Equal(t, 10, report.Steps[0].Result.NumberOfQueries)
+}
+
+// testFailingClient fails every query
+type testFailingClient struct{}
+
+func (t *testFailingClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testFailingClient) Query(_ context.Context, _ string) (*client.Response, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestRunStopsWhenCircuitBreakerTrips(t *testing.T) {
+	t.Parallel()
+	spec, err := ParseSpec("workers=4,8", time.Minute)
+	assert.NoError(t, err)
+
+	// the queries dropped after the breaker trips free their worker slot, or the next read waits for it forever
+	options := workerpool.Options{CircuitBreaker: workerpool.CircuitBreaker{MaxConsecutiveFailures: 1}}
+	for range 200 {
+		report, err := Run(context.Background(), spec, &testFailingClient{}, &testEndlessReader{}, 0, options)
+		assert.ErrorIs(t, err, workerpool.ErrDatabaseUnhealthy)
+		assert.Len(t, report.Steps, 1)
+	}
+}
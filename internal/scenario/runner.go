@@ -0,0 +1,299 @@
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/input"
+	"github.com/vrnvu/go-sql/internal/metrics"
+	"github.com/vrnvu/go-sql/internal/query"
+	"github.com/vrnvu/go-sql/internal/workerpool"
+)
+
+// Client is a database client that holds connections until closed
+type Client interface {
+	client.Client
+	Close() error
+}
+
+// ClientFactory creates a client with a connection per worker
+type ClientFactory func(ctx context.Context, connection Connection, workers int) (Client, error)
+
+// Runner executes a Scenario
+type Runner struct {
+	scenario  *Scenario
+	newClient ClientFactory
+}
+
+// NewRunner creates a new Runner
+func NewRunner(scenario *Scenario, newClient ClientFactory) *Runner {
+	return &Runner{scenario: scenario, newClient: newClient}
+}
+
+// Run executes setup, warmup, every phase and teardown in order
+// A failing phase stops the scenario, the report holds the phases run so far and teardown still runs
+func (r *Runner) Run(ctx context.Context) (Report, error) {
+	report := Report{Name: r.scenario.Name}
+
+	if err := r.exec(ctx, "setup", r.scenario.Setup); err != nil {
+		return report, err
+	}
+
+	err := r.runPhases(ctx, &report)
+
+	// teardown runs even when the context is done, bounded by its own timeout
+	teardownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+	defer cancel()
+	if teardownErr := r.exec(teardownCtx, "teardown", r.scenario.Teardown); teardownErr != nil && err == nil {
+		err = teardownErr
+	}
+
+	return report, err
+}
+
+func (r *Runner) runPhases(ctx context.Context, report *Report) error {
+	if r.scenario.Warmup != nil {
+		phaseReport, err := r.runPhase(ctx, *r.scenario.Warmup)
+		phaseReport.Warmup = true
+		report.Phases = append(report.Phases, phaseReport)
+		if err != nil {
+			return fmt.Errorf("warmup: %w", err)
+		}
+	}
+
+	for _, phase := range r.scenario.Phases {
+		phaseReport, err := r.runPhase(ctx, phase)
+		report.Phases = append(report.Phases, phaseReport)
+		if err != nil {
+			return fmt.Errorf("phase %q: %w", phase.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// exec runs the statements in order with a single connection
+func (r *Runner) exec(ctx context.Context, name string, statements []string) error {
+	if len(statements) == 0 {
+		return nil
+	}
+
+	client, err := r.newClient(ctx, r.scenario.Connection, 1)
+	if err != nil {
+		return fmt.Errorf("%s: error creating client: %w", name, err)
+	}
+	defer client.Close()
+
+	for i, statement := range statements {
+		log.Printf("scenario %s: statement %d of %d", name, i+1, len(statements))
+		if _, err := client.Query(ctx, statement); err != nil {
+			return fmt.Errorf("%s: statement %d failed: %w", name, i+1, err)
+		}
+	}
+	return nil
+}
+
+func (r *Runner) runPhase(ctx context.Context, phase Phase) (PhaseReport, error) {
+	phaseReport := PhaseReport{Name: phase.Name, Workers: phase.Workers, Strategy: phase.Strategy, Rate: phase.Rate}
+	log.Printf("scenario: starting phase %q with %d workers", phase.Name, phase.Workers)
+
+	reader, closer, err := r.openPhaseInput(phase)
+	if err != nil {
+		return phaseReport, err
+	}
+	defer closer.Close()
+
+	client, err := r.newClient(ctx, r.scenario.Connection, phase.Workers)
+	if err != nil {
+		return phaseReport, fmt.Errorf("error creating client: %w", err)
+	}
+	defer client.Close()
+
+	options := workerpool.Options{
+		ErrorPolicy: workerpool.ErrorPolicy{
+			Mode:            phase.ErrorPolicy,
+			MaxSkipped:      phase.MaxSkipped,
+			MaxSkippedRatio: phase.MaxSkippedRatio,
+		},
+		Strategy:      phase.Strategy,
+		TargetRate:    phase.Rate,
+		WorkStealing:  phase.WorkStealing,
+		MaxRate:       phase.MaxRate,
+		MaxWorkerRate: phase.MaxWorkerRate,
+		CircuitBreaker: workerpool.CircuitBreaker{
+			MaxFailureRatio:        phase.MaxFailureRatio,
+			FailureWindow:          phase.FailureWindow,
+			MaxConsecutiveFailures: phase.MaxConsecutiveFailures,
+		},
+	}
+	wp, err := workerpool.NewWithOptions(phase.Workers, client, reader, options)
+	if err != nil {
+		return phaseReport, err
+	}
+
+	start := time.Now()
+	phaseReport.Result, err = wp.Run(ctx)
+	phaseReport.WallTime = time.Since(start)
+	return phaseReport, err
+}
+
+// openPhaseInput builds the reader of the phase input, looped for the phase duration
+func (r *Runner) openPhaseInput(phase Phase) (query.Reader, io.Closer, error) {
+	options := query.Options{TagColumns: phase.Input.TagColumns}
+	if phase.Input.Template != "" {
+		content, err := os.ReadFile(r.scenario.path(phase.Input.Template))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading template: %w", err)
+		}
+		if options.Template, err = query.ParseTemplate(string(content)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var open query.LoopOpener
+	if phase.Input.Generate != "" {
+		open = func() (query.Reader, io.Closer, error) {
+			spec, err := query.ParseGeneratorSpec(phase.Input.Generate)
+			if err != nil {
+				return nil, nil, err
+			}
+			generator, err := query.NewGenerator(spec)
+			return generator, nil, err
+		}
+	} else {
+		patterns := make([]string, len(phase.Input.Paths))
+		for i, pattern := range phase.Input.Paths {
+			patterns[i] = r.scenario.path(pattern)
+		}
+		paths, err := input.Expand(patterns)
+		if err != nil {
+			return nil, nil, err
+		}
+		open = func() (query.Reader, io.Closer, error) {
+			reader, err := query.NewMultiReader(paths, func(path string) (query.Reader, io.Closer, error) {
+				return openFile(path, phase.Input.Format, options)
+			})
+			return reader, reader, err
+		}
+	}
+
+	// a single pass is a loop of one, so the input is always closed by the loop reader
+	loopReader, err := query.NewLoopReader(open, loopTimes(phase), time.Duration(phase.Duration))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reader, err := decorate(loopReader, phase)
+	if err != nil {
+		_ = loopReader.Close()
+		return nil, nil, err
+	}
+	return reader, loopReader, nil
+}
+
+// loopTimes reads the input once, unless the phase has a duration
+func loopTimes(phase Phase) int {
+	if phase.Duration > 0 {
+		return 0
+	}
+	return 1
+}
+
+func decorate(reader query.Reader, phase Phase) (query.Reader, error) {
+	var err error
+	if phase.Input.Limit > 0 {
+		if reader, err = query.NewLimitReader(reader, phase.Input.Limit); err != nil {
+			return nil, err
+		}
+	}
+	if phase.Input.Shuffle > 0 {
+		if reader, err = query.NewShuffleReader(reader, phase.Input.Shuffle, phase.Input.Seed); err != nil {
+			return nil, err
+		}
+	}
+	if phase.Input.Mix != "" {
+		mix, err := query.ParseMix(phase.Input.Mix)
+		if err != nil {
+			return nil, err
+		}
+		if reader, err = query.NewMixReader(reader, mix, phase.Input.Seed, 8); err != nil {
+			return nil, err
+		}
+	}
+	return reader, nil
+}
+
+func openFile(path string, format string, options query.Options) (query.Reader, io.Closer, error) {
+	file, err := input.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "" {
+		format = input.Format(path)
+	}
+
+	reader, err := query.NewReader(file, format, options)
+	if err != nil {
+		_ = file.Close()
+		return nil, nil, err
+	}
+	return reader, file, nil
+}
+
+// PhaseReport is the result of a single phase
+type PhaseReport struct {
+	Name     string
+	Warmup   bool
+	Workers  int
+	Strategy workerpool.Strategy
+	Rate     float64
+	WallTime time.Duration
+	Result   metrics.Result
+}
+
+// Throughput is the number of successful queries per second of wall time
+func (p PhaseReport) Throughput() float64 {
+	if p.WallTime <= 0 {
+		return 0
+	}
+	return float64(p.Result.NumberOfQueries) / p.WallTime.Seconds()
+}
+
+// Report is the combined result of every phase of a scenario
+type Report struct {
+	Name   string
+	Phases []PhaseReport
+}
+
+// Table prints a summary line per phase followed by the metrics of each phase
+func (r *Report) Table() string {
+	builder := strings.Builder{}
+	builder.WriteString("\n\n=====================\n")
+	builder.WriteString(fmt.Sprintf("Scenario: %s\n", r.Name))
+	builder.WriteString("=====================\n")
+	for _, phase := range r.Phases {
+		name := phase.Name
+		if phase.Warmup && name != "warmup" {
+			name += " (warmup)"
+		}
+		strategy := phase.Strategy
+		if strategy == "" {
+			strategy = workerpool.StrategySticky
+		}
+		builder.WriteString(fmt.Sprintf("%s: workers %d, strategy %s, queries %d, skipped %d, failed %d, median %v, max %v, wall time %v, throughput %.2f qps\n",
+			name, phase.Workers, strategy, phase.Result.NumberOfQueries, phase.Result.SkippedQueries, phase.Result.FailedQueries,
+			phase.Result.MedianResponse, phase.Result.MaxResponse, phase.WallTime.Round(time.Millisecond), phase.Throughput()))
+	}
+
+	for _, phase := range r.Phases {
+		builder.WriteString(fmt.Sprintf("\n--- %s ---", phase.Name))
+		builder.WriteString(phase.Result.Table())
+	}
+	return builder.String()
+}
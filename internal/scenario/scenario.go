@@ -0,0 +1,193 @@
+package scenario
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vrnvu/go-sql/internal/workerpool"
+)
+
+// Scenario is a multi phase experiment: setup SQL, an optional warmup, measurement phases and teardown SQL
+// Phases run one after the other, each with its own connection pool, and produce one combined Report
+type Scenario struct {
+	Name       string     `json:"name"`
+	Connection Connection `json:"connection"`
+	// Setup statements run once before the first phase, e.g. to create or warm caches
+	Setup []string `json:"setup"`
+	// Warmup is run before the phases to fill caches and connection pools, it is flagged in the Report
+	Warmup *Phase  `json:"warmup"`
+	Phases []Phase `json:"phases"`
+	// Teardown statements run once after the last phase, also when a phase fails
+	Teardown []string `json:"teardown"`
+
+	// dir is the directory of the scenario file, relative input and template paths are resolved from it
+	dir string
+}
+
+// Connection is the database of the scenario, empty fields default to the CLI defaults
+type Connection struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Host     string `json:"host"`
+	Port     string `json:"port"`
+	Database string `json:"database"`
+}
+
+// Phase is a single measurement with its own workers, rate, duration and input
+type Phase struct {
+	Name    string `json:"name"`
+	Workers int    `json:"workers"`
+	// Strategy is how queries are assigned to workers, see workerpool.Strategy
+	Strategy workerpool.Strategy `json:"strategy"`
+	// WorkStealing lets idle workers take queries queued for busy ones, see workerpool.Options.WorkStealing
+	WorkStealing bool `json:"work_stealing"`
+	// Rate is the number of queries per second sent to the workers, see workerpool.Options.TargetRate. Unlimited when 0
+	Rate float64 `json:"rate"`
+	// MaxRate and MaxWorkerRate cap the queries per second of the workers, see workerpool.Options.MaxRate
+	MaxRate       float64 `json:"max_rate"`
+	MaxWorkerRate float64 `json:"max_worker_rate"`
+	// Duration reads the input again and again until it has passed, the input is read once when 0
+	Duration Duration `json:"duration"`
+	Input    Input    `json:"input"`
+	// ErrorPolicy is lenient, strict or threshold, see workerpool.ErrorPolicy
+	ErrorPolicy     workerpool.ErrorMode `json:"error_policy"`
+	MaxSkipped      int                  `json:"max_skipped"`
+	MaxSkippedRatio float64              `json:"max_skipped_ratio"`
+	// MaxFailureRatio, FailureWindow and MaxConsecutiveFailures abort the phase when the database is down, see workerpool.CircuitBreaker
+	MaxFailureRatio        float64 `json:"max_failure_ratio"`
+	FailureWindow          int     `json:"failure_window"`
+	MaxConsecutiveFailures int     `json:"max_consecutive_failures"`
+}
+
+// Input is the workload of a phase, either files or a generator spec
+type Input struct {
+	// Paths are files, globs or directories, see input.Expand
+	Paths []string `json:"paths"`
+	// Format is csv, ndjson, stderr or csvlog, defaults to the file extension
+	Format string `json:"format"`
+	// Generate is a generator spec, see query.ParseGeneratorSpec
+	Generate   string   `json:"generate"`
+	Template   string   `json:"template"`
+	Mix        string   `json:"mix"`
+	TagColumns []string `json:"tag_columns"`
+	Limit      int      `json:"limit"`
+	Shuffle    int      `json:"shuffle"`
+	Seed       int64    `json:"seed"`
+}
+
+// Duration is a time.Duration written as a string in JSON, e.g. "30s" or "5m"
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Load reads and validates a JSON scenario file
+func Load(path string) (*Scenario, error) {
+	content, err := os.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("error reading scenario: %w", err)
+	}
+
+	scenario, err := Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	scenario.dir = filepath.Dir(path)
+
+	return scenario, nil
+}
+
+// Parse parses and validates a JSON scenario, unknown fields are rejected to catch typos
+func Parse(content []byte) (*Scenario, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+
+	scenario := &Scenario{}
+	if err := decoder.Decode(scenario); err != nil {
+		return nil, err
+	}
+	if err := scenario.validate(); err != nil {
+		return nil, err
+	}
+
+	return scenario, nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Phases) == 0 {
+		return fmt.Errorf("at least one phase is required")
+	}
+
+	if s.Warmup != nil {
+		if s.Warmup.Name == "" {
+			s.Warmup.Name = "warmup"
+		}
+		if err := s.Warmup.validate(); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool)
+	for i := range s.Phases {
+		phase := &s.Phases[i]
+		if phase.Name == "" {
+			phase.Name = fmt.Sprintf("phase %d", i+1)
+		}
+		if names[phase.Name] {
+			return fmt.Errorf("duplicated phase name %q", phase.Name)
+		}
+		names[phase.Name] = true
+
+		if err := phase.validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Phase) validate() error {
+	if p.Workers < 1 || p.Workers > workerpool.MaxWorkers {
+		return fmt.Errorf("phase %q: workers %d must be greater than 0 and less than %d", p.Name, p.Workers, workerpool.MaxWorkers)
+	}
+	if p.Rate < 0 {
+		return fmt.Errorf("phase %q: rate %v must be greater or equal than 0", p.Name, p.Rate)
+	}
+	if p.Duration < 0 {
+		return fmt.Errorf("phase %q: duration %v must be greater or equal than 0", p.Name, time.Duration(p.Duration))
+	}
+	if (len(p.Input.Paths) == 0) == (p.Input.Generate == "") {
+		return fmt.Errorf("phase %q: input needs either paths or generate", p.Name)
+	}
+	if p.Input.Mix != "" && p.Input.Template != "" {
+		return fmt.Errorf("phase %q: mix and template can not be used together", p.Name)
+	}
+	return nil
+}
+
+// path resolves a path of the scenario file relative to its directory
+func (s *Scenario) path(path string) string {
+	if s.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(s.dir, path)
+}
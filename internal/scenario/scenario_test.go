@@ -0,0 +1,189 @@
+package scenario
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/metrics"
+	"github.com/vrnvu/go-sql/internal/workerpool"
+)
+
+// testClient records every query and answers in 1ms, queries listed in fail return an error
+type testClient struct {
+	mu      sync.Mutex
+	queries []string
+	clients []int
+	closed  int
+	fail    map[string]bool
+}
+
+func (t *testClient) factory(_ context.Context, _ Connection, workers int) (Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.clients = append(t.clients, workers)
+	return t, nil
+}
+
+func (t *testClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testClient) Query(_ context.Context, query string) (*client.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.queries = append(t.queries, query)
+	if t.fail[query] {
+		return nil, errors.New("test error")
+	}
+	return &client.Response{Duration: time.Millisecond}, nil
+}
+
+func (t *testClient) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed++
+	return nil
+}
+
+func TestLoadExample(t *testing.T) {
+	t.Parallel()
+	scenario, err := Load("../../resources/scenario.json")
+	assert.NoError(t, err)
+	assert.Equal(t, "cpu usage baseline", scenario.Name)
+	assert.Equal(t, "warmup", scenario.Warmup.Name)
+	assert.Len(t, scenario.Phases, 2)
+	assert.Equal(t, Duration(30*time.Second), scenario.Phases[1].Duration)
+	assert.Equal(t, "../../resources/query_params.csv", scenario.path(scenario.Phases[0].Input.Paths[0]))
+}
+
+func TestParseErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	for _, content := range []string{
+		`{"phases": []}`,
+		`{"phases": [{"workers": 1, "input": {"generate": "count=1"}}], "setpu": []}`,
+		`{"phases": [{"workers": 0, "input": {"generate": "count=1"}}]}`,
+		`{"phases": [{"workers": 1, "input": {}}]}`,
+		`{"phases": [{"workers": 1, "input": {"paths": ["a.csv"], "generate": "count=1"}}]}`,
+		`{"phases": [{"workers": 1, "rate": -1, "input": {"generate": "count=1"}}]}`,
+		`{"phases": [{"workers": 1, "duration": "soon", "input": {"generate": "count=1"}}]}`,
+		`{"phases": [{"name": "a", "workers": 1, "input": {"generate": "count=1"}}, {"name": "a", "workers": 1, "input": {"generate": "count=1"}}]}`,
+		`{"phases": [{"workers": 1, "input": {"generate": "count=1", "mix": "lastpoint=1", "template": "a.sql"}}]}`,
+		`{"warmup": {"workers": 1, "input": {}}, "phases": [{"workers": 1, "input": {"generate": "count=1"}}]}`,
+	} {
+		_, err := Parse([]byte(content))
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestRunnerRunsEveryPhase(t *testing.T) {
+	t.Parallel()
+	scenario, err := Load("../../resources/scenario.json")
+	assert.NoError(t, err)
+	// keep the test fast, the rate and duration are covered by TestRunnerPacesRate
+	scenario.Phases[1].Rate = 0
+	scenario.Phases[1].Duration = 0
+	scenario.Phases[1].Input.Generate = "seed=42,count=100,hosts=20,popularity=zipf"
+
+	testClient := &testClient{}
+	report, err := NewRunner(scenario, testClient.factory).Run(context.Background())
+	assert.NoError(t, err)
+
+	// setup, warmup, phases and teardown each get their own client
+	assert.Equal(t, []int{1, 4, 4, 8, 1}, testClient.clients)
+	assert.Equal(t, 5, testClient.closed)
+	assert.Equal(t, "ANALYZE cpu_usage", testClient.queries[0])
+	assert.Equal(t, "SELECT pg_stat_reset()", testClient.queries[len(testClient.queries)-1])
+	assert.Len(t, testClient.queries, 1+50+200+100+1)
+
+	assert.Len(t, report.Phases, 3)
+	assert.True(t, report.Phases[0].Warmup)
+	assert.Equal(t, 50, report.Phases[0].Result.NumberOfQueries)
+	assert.Equal(t, "csv replay", report.Phases[1].Name)
+	assert.Equal(t, 200, report.Phases[1].Result.NumberOfQueries)
+	assert.Equal(t, 100, report.Phases[2].Result.NumberOfQueries)
+	// the phase mix is applied to the generated queries
+	assert.Contains(t, report.Phases[2].Result.ByQueryType, "lastpoint")
+}
+
+func TestRunnerSetupFailureSkipsPhases(t *testing.T) {
+	t.Parallel()
+	scenario, err := Parse([]byte(`{
+		"setup": ["CREATE INDEX"],
+		"phases": [{"workers": 1, "input": {"generate": "count=10"}}],
+		"teardown": ["DROP INDEX"]
+	}`))
+	assert.NoError(t, err)
+
+	testClient := &testClient{fail: map[string]bool{"CREATE INDEX": true}}
+	report, err := NewRunner(scenario, testClient.factory).Run(context.Background())
+	assert.EqualError(t, err, "setup: statement 1 failed: test error")
+	assert.Empty(t, report.Phases)
+	assert.Equal(t, []string{"CREATE INDEX"}, testClient.queries)
+}
+
+func TestRunnerTeardownAfterFailedPhase(t *testing.T) {
+	t.Parallel()
+	scenario, err := Parse([]byte(`{
+		"phases": [
+			{"name": "bad", "workers": 1, "error_policy": "strict", "input": {"paths": ["../../resources/invalid_row.csv"]}},
+			{"name": "never", "workers": 1, "input": {"generate": "count=10"}}
+		],
+		"teardown": ["DROP INDEX"]
+	}`))
+	assert.NoError(t, err)
+
+	testClient := &testClient{}
+	report, err := NewRunner(scenario, testClient.factory).Run(context.Background())
+	assert.ErrorContains(t, err, `phase "bad": aborted: too many skipped input rows`)
+	assert.Len(t, report.Phases, 1)
+	assert.Equal(t, "DROP INDEX", testClient.queries[len(testClient.queries)-1])
+}
+
+func TestRunnerPacesRate(t *testing.T) {
+	t.Parallel()
+	scenario, err := Parse([]byte(`{"phases": [{"workers": 2, "rate": 100, "input": {"generate": "count=20"}}]}`))
+	assert.NoError(t, err)
+
+	testClient := &testClient{}
+	report, err := NewRunner(scenario, testClient.factory).Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 20, report.Phases[0].Result.NumberOfQueries)
+	// 20 queries at 100 per second are released over at least 190ms
+	assert.GreaterOrEqual(t, report.Phases[0].WallTime, 190*time.Millisecond)
+}
+
+func TestRunnerLoopsForDuration(t *testing.T) {
+	t.Parallel()
+	scenario, err := Parse([]byte(`{"phases": [{"workers": 2, "duration": "200ms", "rate": 200, "input": {"generate": "count=5"}}]}`))
+	assert.NoError(t, err)
+
+	testClient := &testClient{}
+	report, err := NewRunner(scenario, testClient.factory).Run(context.Background())
+	assert.NoError(t, err)
+	// the 5 generated queries are read again until the duration has passed
+	assert.Greater(t, report.Phases[0].Result.NumberOfQueries, 5)
+}
+
+func TestReportTableSnapshot(t *testing.T) {
+	t.Parallel()
+	result := metrics.Result{
+		NumberOfQueries:     100,
+		TotalProcessingTime: time.Second,
+		MinResponse:         time.Millisecond,
+		MedianResponse:      10 * time.Millisecond,
+		AverageResponse:     10 * time.Millisecond,
+		MaxResponse:         50 * time.Millisecond,
+	}
+	report := Report{Name: "test", Phases: []PhaseReport{
+		{Name: "warmup", Warmup: true, Workers: 2, WallTime: 500 * time.Millisecond, Result: result},
+		{Name: "steady", Workers: 4, Strategy: workerpool.StrategyShared, Rate: 200, WallTime: 2 * time.Second, Result: result},
+	}}
+	snaps.MatchSnapshot(t, report.Table())
+}
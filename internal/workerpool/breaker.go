@@ -0,0 +1,89 @@
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultFailureWindow is the number of recent queries CircuitBreaker.MaxFailureRatio is checked over
+const DefaultFailureWindow = 100
+
+// ErrDatabaseUnhealthy is returned by Run when the circuit breaker aborts the run
+var ErrDatabaseUnhealthy = errors.New("aborted: database unhealthy")
+
+// CircuitBreaker aborts a run once the database looks down instead of failing every query until the timeout
+// The zero value never aborts
+type CircuitBreaker struct {
+	// MaxFailureRatio aborts once the failed share of the last FailureWindow queries is above it, disabled when 0
+	MaxFailureRatio float64
+	// FailureWindow is the number of queries of the ratio, defaults to DefaultFailureWindow
+	FailureWindow int
+	// MaxConsecutiveFailures aborts once that many queries in a row failed, disabled when 0
+	MaxConsecutiveFailures int
+}
+
+func (c CircuitBreaker) validate() error {
+	if c.MaxFailureRatio < 0 || c.MaxFailureRatio > 1 || c.FailureWindow < 0 || c.MaxConsecutiveFailures < 0 {
+		return fmt.Errorf("max failure ratio %v must be in [0, 1], failure window %d and max consecutive failures %d greater or equal than 0",
+			c.MaxFailureRatio, c.FailureWindow, c.MaxConsecutiveFailures)
+	}
+	return nil
+}
+
+// breaker keeps the outcome of the last queries of a run, only used by the metrics collector so it needs no lock
+type breaker struct {
+	maxRatio       float64
+	maxConsecutive int
+
+	// window is a ring of the last outcomes, true for failed queries
+	window      []bool
+	next        int
+	filled      int
+	failures    int
+	consecutive int
+}
+
+// newBreaker creates the breaker of a CircuitBreaker, nil when it never aborts
+func newBreaker(c CircuitBreaker) *breaker {
+	if c.MaxFailureRatio == 0 && c.MaxConsecutiveFailures == 0 {
+		return nil
+	}
+	size := c.FailureWindow
+	if size == 0 {
+		size = DefaultFailureWindow
+	}
+	return &breaker{maxRatio: c.MaxFailureRatio, maxConsecutive: c.MaxConsecutiveFailures, window: make([]bool, size)}
+}
+
+// record adds the outcome of a query and returns ErrDatabaseUnhealthy once the run should abort
+// The ratio is only checked once the window is full, so a failed first query does not abort the run
+func (b *breaker) record(failed bool) error {
+	if b == nil {
+		return nil
+	}
+
+	if b.window[b.next] {
+		b.failures--
+	}
+	b.window[b.next] = failed
+	b.next = (b.next + 1) % len(b.window)
+	b.filled = min(b.filled+1, len(b.window))
+
+	if failed {
+		b.failures++
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+
+	if b.maxConsecutive > 0 && b.consecutive >= b.maxConsecutive {
+		return fmt.Errorf("%w: %d queries in a row failed", ErrDatabaseUnhealthy, b.consecutive)
+	}
+	if b.maxRatio > 0 && b.filled == len(b.window) {
+		if ratio := float64(b.failures) / float64(b.filled); ratio > b.maxRatio {
+			return fmt.Errorf("%w: %d of the last %d queries failed, a ratio of %.3f, more than the max of %.3f",
+				ErrDatabaseUnhealthy, b.failures, b.filled, ratio, b.maxRatio)
+		}
+	}
+	return nil
+}
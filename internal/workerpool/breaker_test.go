@@ -0,0 +1,61 @@
+package workerpool
+
+import (
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerDisabled(t *testing.T) {
+	t.Parallel()
+	b := newBreaker(CircuitBreaker{})
+	assert.Nil(t, b)
+	for range 1000 {
+		assert.NoError(t, b.record(true))
+	}
+}
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	t.Parallel()
+	b := newBreaker(CircuitBreaker{MaxConsecutiveFailures: 3})
+	assert.NoError(t, b.record(true))
+	assert.NoError(t, b.record(true))
+	// a successful query resets the count
+	assert.NoError(t, b.record(false))
+	assert.NoError(t, b.record(true))
+	assert.NoError(t, b.record(true))
+
+	err := b.record(true)
+	assert.ErrorIs(t, err, ErrDatabaseUnhealthy)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	t.Parallel()
+	b := newBreaker(CircuitBreaker{MaxFailureRatio: 0.5, FailureWindow: 4})
+	// the ratio is not checked before the window is full
+	assert.NoError(t, b.record(true))
+	assert.NoError(t, b.record(true))
+	assert.NoError(t, b.record(false))
+	assert.NoError(t, b.record(false))
+	// the oldest failures slide out of the window
+	assert.NoError(t, b.record(false))
+	assert.NoError(t, b.record(true))
+	assert.NoError(t, b.record(true))
+
+	err := b.record(true)
+	assert.ErrorIs(t, err, ErrDatabaseUnhealthy)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func TestCircuitBreakerValidate(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, CircuitBreaker{}.validate())
+	assert.NoError(t, CircuitBreaker{MaxFailureRatio: 0.5, FailureWindow: 10, MaxConsecutiveFailures: 5}.validate())
+	for _, c := range []CircuitBreaker{{MaxFailureRatio: -0.1}, {MaxFailureRatio: 1.1}, {FailureWindow: -1}, {MaxConsecutiveFailures: -1}} {
+		err := c.validate()
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
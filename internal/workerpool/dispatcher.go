@@ -0,0 +1,205 @@
+package workerpool
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/vrnvu/go-sql/internal/query"
+)
+
+// Strategy is how the WorkerPool assigns queries to workers
+type Strategy string
+
+const (
+	// StrategySticky pins a hostname to a worker, new hostnames are assigned round robin, the default
+	StrategySticky Strategy = "sticky"
+	// StrategyHash pins a hostname to a worker by consistent hashing, the assignment does not depend on the input order
+	StrategyHash Strategy = "hash"
+	// StrategyRoundRobin assigns each query to the next worker, regardless of the hostname
+	StrategyRoundRobin Strategy = "round-robin"
+	// StrategyLeastOutstanding assigns each query to the worker with the fewest queries sent and not yet run
+	StrategyLeastOutstanding Strategy = "least-outstanding"
+	// StrategyShared puts every query on a single queue all the workers read from, an idle worker takes the next query
+	StrategyShared Strategy = "shared"
+)
+
+// Strategies are the strategies NewDispatcher can create
+var Strategies = []Strategy{StrategySticky, StrategyHash, StrategyRoundRobin, StrategyLeastOutstanding, StrategyShared}
+
+// Dispatcher assigns queries to the queues the workers read from
+// Dispatch is only called by the goroutine reading the input, Done is called concurrently by the workers
+type Dispatcher interface {
+	// Queues is the number of queues, worker i reads from queue i % Queues()
+	Queues() int
+	// Dispatch returns the queue of the query
+	Dispatch(query query.Query) int
+	// Done is called by a worker after running a query of the queue
+	Done(queue int)
+}
+
+// NewDispatcher creates the Dispatcher of a strategy for numWorkers workers, the empty strategy is StrategySticky
+func NewDispatcher(strategy Strategy, numWorkers int) (Dispatcher, error) {
+	if numWorkers < 1 {
+		return nil, fmt.Errorf("number of workers must be greater than 0")
+	}
+
+	switch strategy {
+	case "", StrategySticky:
+		return newStickyDispatcher(numWorkers), nil
+	case StrategyHash:
+		return newHashDispatcher(numWorkers), nil
+	case StrategyRoundRobin:
+		return &roundRobinDispatcher{numWorkers: numWorkers}, nil
+	case StrategyLeastOutstanding:
+		return &leastOutstandingDispatcher{outstanding: make([]atomic.Int64, numWorkers)}, nil
+	case StrategyShared:
+		return sharedDispatcher{}, nil
+	default:
+		return nil, fmt.Errorf("unknown dispatch strategy %q, expected one of %v", strategy, Strategies)
+	}
+}
+
+// stickyDispatcher maps each hostname to a worker, new hostnames are assigned round robin
+// For example, with 4 workers:
+// query.hostname = "host1" -> queue 0
+// query.hostname = "host3" -> queue 1
+// query.hostname = "host2" -> queue 2
+// query.hostname = "host1" -> queue 0
+// query.hostname = "host4" -> queue 3
+// query.hostname = "host5" -> queue 0 // idx % numWorkers
+type stickyDispatcher struct {
+	numWorkers          int
+	mapHostnameToWorker map[string]int
+	lastWorkerIdx       int
+}
+
+func newStickyDispatcher(numWorkers int) *stickyDispatcher {
+	return &stickyDispatcher{numWorkers: numWorkers, mapHostnameToWorker: make(map[string]int)}
+}
+
+func (d *stickyDispatcher) Queues() int {
+	return d.numWorkers
+}
+
+func (d *stickyDispatcher) Dispatch(query query.Query) int {
+	if worker, exists := d.mapHostnameToWorker[query.Hostname]; exists {
+		return worker
+	}
+
+	worker := d.lastWorkerIdx
+	d.mapHostnameToWorker[query.Hostname] = worker
+	d.lastWorkerIdx = (d.lastWorkerIdx + 1) % d.numWorkers
+	return worker
+}
+
+func (d *stickyDispatcher) Done(_ int) {}
+
+// virtualNodes is the number of points of each worker on the hash ring, more points spread hostnames more evenly
+const virtualNodes = 100
+
+// hashDispatcher places virtualNodes points per worker on a hash ring, a hostname goes to the worker of the next point
+// Unlike stickyDispatcher, the worker of a hostname is the same for every run and input order
+type hashDispatcher struct {
+	numWorkers int
+	points     []uint64
+	workers    map[uint64]int
+}
+
+func newHashDispatcher(numWorkers int) *hashDispatcher {
+	d := &hashDispatcher{numWorkers: numWorkers, workers: make(map[uint64]int, numWorkers*virtualNodes)}
+	for worker := range numWorkers {
+		for node := range virtualNodes {
+			point := hash(strconv.Itoa(worker) + "-" + strconv.Itoa(node))
+			// on a collision the first worker keeps the point
+			if _, exists := d.workers[point]; !exists {
+				d.workers[point] = worker
+				d.points = append(d.points, point)
+			}
+		}
+	}
+	slices.Sort(d.points)
+	return d
+}
+
+func (d *hashDispatcher) Queues() int {
+	return d.numWorkers
+}
+
+func (d *hashDispatcher) Dispatch(query query.Query) int {
+	i, _ := slices.BinarySearch(d.points, hash(query.Hostname))
+	if i == len(d.points) {
+		i = 0
+	}
+	return d.workers[d.points[i]]
+}
+
+func (d *hashDispatcher) Done(_ int) {}
+
+// hash is FNV-1a with the splitmix64 finalizer, FNV alone clusters similar hostnames like host_000001 and host_000002
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(value))
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// roundRobinDispatcher assigns each query to the next worker
+type roundRobinDispatcher struct {
+	numWorkers int
+	next       int
+}
+
+func (d *roundRobinDispatcher) Queues() int {
+	return d.numWorkers
+}
+
+func (d *roundRobinDispatcher) Dispatch(_ query.Query) int {
+	worker := d.next
+	d.next = (d.next + 1) % d.numWorkers
+	return worker
+}
+
+func (d *roundRobinDispatcher) Done(_ int) {}
+
+// leastOutstandingDispatcher counts the queries dispatched to each worker and not yet run
+// Ties go to the lowest worker
+type leastOutstandingDispatcher struct {
+	outstanding []atomic.Int64
+}
+
+func (d *leastOutstandingDispatcher) Queues() int {
+	return len(d.outstanding)
+}
+
+func (d *leastOutstandingDispatcher) Dispatch(_ query.Query) int {
+	worker := 0
+	for i := range d.outstanding {
+		if d.outstanding[i].Load() < d.outstanding[worker].Load() {
+			worker = i
+		}
+	}
+	d.outstanding[worker].Add(1)
+	return worker
+}
+
+func (d *leastOutstandingDispatcher) Done(queue int) {
+	d.outstanding[queue].Add(-1)
+}
+
+// sharedDispatcher has a single queue for every worker
+type sharedDispatcher struct{}
+
+func (sharedDispatcher) Queues() int {
+	return 1
+}
+
+func (sharedDispatcher) Dispatch(_ query.Query) int {
+	return 0
+}
+
+func (sharedDispatcher) Done(_ int) {}
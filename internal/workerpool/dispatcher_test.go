@@ -0,0 +1,129 @@
+package workerpool
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/gkampitakis/go-snaps/snaps"
+	"github.com/stretchr/testify/assert"
+	"github.com/vrnvu/go-sql/internal/query"
+	"pgregory.net/rapid"
+)
+
+func dispatchHostnames(dispatcher Dispatcher, hostnames ...string) []int {
+	queues := make([]int, len(hostnames))
+	for i, hostname := range hostnames {
+		queues[i] = dispatcher.Dispatch(query.Query{Hostname: hostname})
+	}
+	return queues
+}
+
+func TestStickyDispatcher(t *testing.T) {
+	t.Parallel()
+	dispatcher, err := NewDispatcher(StrategySticky, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, dispatcher.Queues())
+	assert.Equal(t, []int{0, 1, 2, 0, 3, 0, 1}, dispatchHostnames(dispatcher, "host1", "host3", "host2", "host1", "host4", "host5", "host3"))
+}
+
+func TestStickyDispatcherMapsHostnameToWorker(t *testing.T) {
+	t.Parallel()
+	dispatcher := newStickyDispatcher(2)
+
+	worker1 := dispatcher.Dispatch(query.Query{Hostname: "host1"})
+	rapid.Check(t, func(t *rapid.T) {
+		numCalls := rapid.IntRange(1, MaxWorkers).Draw(t, "numCalls")
+		for range numCalls {
+			assert.Equal(t, worker1, dispatcher.Dispatch(query.Query{Hostname: "host1"}))
+		}
+	})
+
+	worker2 := dispatcher.Dispatch(query.Query{Hostname: "host2"})
+	assert.NotEqual(t, worker1, worker2)
+}
+
+func TestHashDispatcher(t *testing.T) {
+	t.Parallel()
+	rapid.Check(t, func(t *rapid.T) {
+		numWorkers := rapid.IntRange(1, 64).Draw(t, "numWorkers")
+		hostnames := rapid.SliceOfN(rapid.StringMatching(`host_[0-9]{6}`), 1, 50).Draw(t, "hostnames")
+
+		first, err := NewDispatcher(StrategyHash, numWorkers)
+		assert.NoError(t, err)
+		second, err := NewDispatcher(StrategyHash, numWorkers)
+		assert.NoError(t, err)
+
+		// the worker of a hostname does not depend on the input order or the run
+		queues := dispatchHostnames(first, hostnames...)
+		assert.Equal(t, queues, dispatchHostnames(first, hostnames...))
+		for i := len(hostnames) - 1; i >= 0; i-- {
+			assert.Equal(t, queues[i], second.Dispatch(query.Query{Hostname: hostnames[i]}))
+		}
+		for _, queue := range queues {
+			assert.Less(t, queue, numWorkers)
+		}
+	})
+}
+
+func TestHashDispatcherSpreadsHostnames(t *testing.T) {
+	t.Parallel()
+	dispatcher, err := NewDispatcher(StrategyHash, 4)
+	assert.NoError(t, err)
+
+	counts := make([]int, 4)
+	for i := range 1000 {
+		counts[dispatcher.Dispatch(query.Query{Hostname: fmt.Sprintf("host_%06d", i)})]++
+	}
+	for _, count := range counts {
+		assert.Greater(t, count, 150)
+	}
+}
+
+func TestRoundRobinDispatcher(t *testing.T) {
+	t.Parallel()
+	dispatcher, err := NewDispatcher(StrategyRoundRobin, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 0, 1}, dispatchHostnames(dispatcher, "host1", "host1", "host1", "host2", "host2"))
+}
+
+func TestLeastOutstandingDispatcher(t *testing.T) {
+	t.Parallel()
+	dispatcher, err := NewDispatcher(StrategyLeastOutstanding, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 0}, dispatchHostnames(dispatcher, "host1", "host1", "host1", "host1"))
+
+	// worker 1 has run its query, so it has the fewest outstanding queries
+	dispatcher.Done(1)
+	assert.Equal(t, []int{1, 1, 2}, dispatchHostnames(dispatcher, "host1", "host1", "host1"))
+}
+
+func TestSharedDispatcher(t *testing.T) {
+	t.Parallel()
+	dispatcher, err := NewDispatcher(StrategyShared, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, dispatcher.Queues())
+	assert.Equal(t, []int{0, 0}, dispatchHostnames(dispatcher, "host1", "host2"))
+}
+
+func TestNewDispatcherUnknownStrategy(t *testing.T) {
+	t.Parallel()
+	_, err := NewDispatcher("random", 4)
+	assert.Error(t, err)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func TestWorkerPoolStrategies(t *testing.T) {
+	t.Parallel()
+	for _, strategy := range Strategies {
+		t.Run(string(strategy), func(t *testing.T) {
+			t.Parallel()
+			wp, err := NewWithOptions(4, &testDeterministicClient{}, &testQueryReader{maxCalls: 100}, Options{Strategy: strategy})
+			assert.NoError(t, err)
+
+			result, err := wp.Run(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 100, result.NumberOfQueries)
+		})
+	}
+}
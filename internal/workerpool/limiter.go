@@ -0,0 +1,55 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket of rate tokens per second holding up to burst tokens
+// Unlike schedule it caps a closed loop run: a query waits for a token only when the workers are faster than the rate
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	// saved is how far next can be behind now, the time to fill the bucket but for the token being taken
+	saved time.Duration
+	// next is when the next token is available, in the past while the bucket holds tokens
+	next  time.Time
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newLimiter creates a limiter of rate queries per second starting with a full bucket, nil when rate is 0 so there is no limit
+// A burst of 1 spreads queries evenly
+func newLimiter(rate float64, burst int) *limiter {
+	if rate == 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	return &limiter{interval: interval, saved: time.Duration(max(burst, 1)-1) * interval, now: time.Now, sleep: sleep}
+}
+
+// wait takes a token, blocking until it is available, and returns how long it was throttled
+// The token is reserved before waiting so concurrent callers queue up one interval apart
+func (l *limiter) wait(ctx context.Context) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	reserved := l.next
+	if full := now.Add(-l.saved); reserved.Before(full) {
+		reserved = full
+	}
+	l.next = reserved.Add(l.interval)
+	l.mu.Unlock()
+
+	throttled := max(reserved.Sub(now), 0)
+	if throttled > 0 {
+		if err := l.sleep(ctx, throttled); err != nil {
+			return throttled, err
+		}
+	}
+	return throttled, nil
+}
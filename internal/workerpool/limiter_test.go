@@ -0,0 +1,104 @@
+package workerpool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterWithoutRate(t *testing.T) {
+	t.Parallel()
+	var l *limiter
+	assert.Nil(t, newLimiter(0, 1))
+
+	throttled, err := l.wait(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, throttled)
+}
+
+func TestLimiterSpreadsQueries(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	l := newLimiter(10, 1)
+	l.now = func() time.Time { return now }
+	l.sleep = func(_ context.Context, _ time.Duration) error { return nil }
+
+	var waits []time.Duration
+	for range 3 {
+		throttled, err := l.wait(context.Background())
+		assert.NoError(t, err)
+		waits = append(waits, throttled)
+	}
+	// callers that do not sleep still queue up one interval apart
+	assert.Equal(t, []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond}, waits)
+
+	// an idle limiter does not save tokens for a burst
+	now = start.Add(time.Hour)
+	throttled, _ := l.wait(context.Background())
+	assert.Zero(t, throttled)
+	throttled, _ = l.wait(context.Background())
+	assert.Equal(t, 100*time.Millisecond, throttled)
+}
+
+func TestLimiterBurst(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	l := newLimiter(10, 3)
+	l.now = func() time.Time { return now }
+	l.sleep = func(_ context.Context, _ time.Duration) error { return nil }
+
+	var waits []time.Duration
+	for range 5 {
+		throttled, err := l.wait(context.Background())
+		assert.NoError(t, err)
+		waits = append(waits, throttled)
+	}
+	// the full bucket serves 3 queries at once, then a query every interval
+	assert.Equal(t, []time.Duration{0, 0, 0, 100 * time.Millisecond, 200 * time.Millisecond}, waits)
+
+	// the bucket refills up to the burst while idle
+	now = start.Add(time.Hour)
+	for range 3 {
+		throttled, _ := l.wait(context.Background())
+		assert.Zero(t, throttled)
+	}
+	throttled, _ := l.wait(context.Background())
+	assert.Equal(t, 100*time.Millisecond, throttled)
+}
+
+func TestLimiterCancelled(t *testing.T) {
+	t.Parallel()
+	l := newLimiter(1, 1)
+	_, err := l.wait(context.Background())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	throttled, err := l.wait(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Positive(t, throttled)
+}
+
+func TestLimiterConcurrentCallers(t *testing.T) {
+	t.Parallel()
+	l := newLimiter(200, 1)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 5 {
+				_, err := l.wait(context.Background())
+				assert.NoError(t, err)
+			}
+		})
+	}
+	wg.Wait()
+	// 20 tokens at 200 per second, the first one is free
+	assert.GreaterOrEqual(t, time.Since(start), 19*5*time.Millisecond)
+}
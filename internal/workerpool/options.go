@@ -0,0 +1,110 @@
+package workerpool
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrorMode is what the WorkerPool does with input rows the query reader skips
+type ErrorMode string
+
+const (
+	// ErrorLenient skips bad rows and keeps running, the default
+	ErrorLenient ErrorMode = "lenient"
+	// ErrorStrict aborts the run on the first bad row
+	ErrorStrict ErrorMode = "strict"
+	// ErrorThreshold aborts the run once the skipped rows pass ErrorPolicy.MaxSkipped or ErrorPolicy.MaxSkippedRatio
+	ErrorThreshold ErrorMode = "threshold"
+)
+
+// minRowsForRatio is the number of rows read before MaxSkippedRatio is checked during the run,
+// so a bad first row does not abort it. The ratio is always checked at the end of the input
+const minRowsForRatio = 100
+
+// ErrSkippedRows is returned by Run when the error policy aborts the run
+var ErrSkippedRows = errors.New("aborted: too many skipped input rows")
+
+// ErrorPolicy decides when skipped input rows abort a run
+// The zero value is lenient
+type ErrorPolicy struct {
+	Mode ErrorMode
+	// MaxSkipped is the number of skipped rows allowed with ErrorThreshold, disabled when 0
+	MaxSkipped int
+	// MaxSkippedRatio is the ratio of skipped to read rows allowed with ErrorThreshold, disabled when 0
+	MaxSkippedRatio float64
+}
+
+// Options configures a WorkerPool
+// The zero value is the behavior of New
+type Options struct {
+	ErrorPolicy ErrorPolicy
+	// Strategy is how queries are assigned to workers, defaults to StrategySticky
+	Strategy Strategy
+	// QueueDepth is the number of queries queued per worker, defaults to DefaultQueueDepth
+	QueueDepth int
+	// GracePeriod is how long the queries in flight have to finish once the context of Run is done,
+	// defaults to DefaultGracePeriod
+	GracePeriod time.Duration
+	// TargetRate is the number of queries per second to send, open loop, see schedule. Closed loop when 0
+	TargetRate float64
+	// WorkStealing lets an idle worker take queued queries from the fullest queue of another worker,
+	// only for strategies with a queue per worker, see WorkerPool.steal
+	WorkStealing bool
+	// Warmup and WarmupQueries are the time and number of queries run before measuring, see window
+	// Warmup queries are run but kept out of the metrics, no warmup when both are 0
+	Warmup        time.Duration
+	WarmupQueries int
+	// Duration stops reading the input once the measurement has run for it, the input should loop to last that long
+	// The input is read until it ends when 0
+	Duration time.Duration
+	// MaxRate caps the queries per second of the pool and MaxWorkerRate of each worker, unlimited when 0, see limiter
+	// They cap closed loop runs, unlike TargetRate they never send faster than the workers can keep up
+	MaxRate       float64
+	MaxWorkerRate float64
+	// RateLimitBurst is the number of queries a rate limit lets through at once after being idle, defaults to 1
+	RateLimitBurst int
+	// CircuitBreaker aborts the run when too many queries fail, never aborts by default
+	CircuitBreaker CircuitBreaker
+	// OnDone is called once for every query read from the input when the pool is done with it, run or dropped
+	// It lets the reader bound the queries read ahead of the workers, e.g. a ramp step, nil by default
+	OnDone func()
+}
+
+func (p ErrorPolicy) validate() error {
+	switch p.Mode {
+	case "", ErrorLenient, ErrorStrict:
+		return nil
+	case ErrorThreshold:
+		if p.MaxSkipped < 0 || p.MaxSkippedRatio < 0 || p.MaxSkippedRatio > 1 {
+			return fmt.Errorf("max skipped %d must be greater or equal than 0 and max skipped ratio %v in [0, 1]", p.MaxSkipped, p.MaxSkippedRatio)
+		}
+		if p.MaxSkipped == 0 && p.MaxSkippedRatio == 0 {
+			return fmt.Errorf("threshold error policy needs a max skipped count or ratio")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown error mode %q, expected lenient, strict or threshold", p.Mode)
+	}
+}
+
+// check returns ErrSkippedRows once the skipped rows of the read rows break the policy
+// done is set at the end of the input, when the ratio is checked regardless of the rows read
+func (p ErrorPolicy) check(skipped int, read int, done bool, err error) error {
+	switch p.Mode {
+	case ErrorStrict:
+		if skipped > 0 {
+			return fmt.Errorf("%w: strict error policy, skipped row: %v", ErrSkippedRows, err)
+		}
+	case ErrorThreshold:
+		if p.MaxSkipped > 0 && skipped > p.MaxSkipped {
+			return fmt.Errorf("%w: skipped %d rows, more than the max of %d, last error: %v", ErrSkippedRows, skipped, p.MaxSkipped, err)
+		}
+		if p.MaxSkippedRatio > 0 && read > 0 && (done || read >= minRowsForRatio) {
+			if ratio := float64(skipped) / float64(read); ratio > p.MaxSkippedRatio {
+				return fmt.Errorf("%w: skipped %d of %d rows, a ratio of %.3f, more than the max of %.3f", ErrSkippedRows, skipped, read, ratio, p.MaxSkippedRatio)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package workerpool
+
+import (
+	"context"
+	"time"
+)
+
+// schedule gives each query an intended start time at a constant rate, the open loop mode of wrk2
+// Without it, a worker sends its next query only after the previous one finishes, so a slow query delays
+// the ones behind it and their latency does not include the wait: the coordinated omission problem
+// Latency measured from the intended start includes the wait
+type schedule struct {
+	start    time.Time
+	interval time.Duration
+	sent     int
+	now      func() time.Time
+	sleep    func(ctx context.Context, d time.Duration) error
+}
+
+// newSchedule creates a schedule of rate queries per second from start, a rate of 0 never waits
+func newSchedule(rate float64, start time.Time) *schedule {
+	s := &schedule{start: start, now: time.Now, sleep: sleep}
+	if rate > 0 {
+		s.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return s
+}
+
+// wait blocks until the intended start of the next query and returns it, zero without a rate
+// When the schedule is behind it returns at once, the intended start stays on the schedule and is not moved to now
+func (s *schedule) wait(ctx context.Context) (time.Time, error) {
+	if s.interval == 0 {
+		return time.Time{}, nil
+	}
+
+	intended := s.start.Add(time.Duration(s.sent) * s.interval)
+	s.sent++
+	if wait := intended.Sub(s.now()); wait > 0 {
+		if err := s.sleep(ctx, wait); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return intended, nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,62 @@
+package workerpool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleWaitsForIntendedStart(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	var waits []time.Duration
+
+	s := newSchedule(10, start)
+	s.now = func() time.Time { return now }
+	s.sleep = func(_ context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		now = now.Add(d)
+		return nil
+	}
+
+	for i := range 3 {
+		intended, err := s.wait(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, start.Add(time.Duration(i)*100*time.Millisecond), intended)
+	}
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}, waits)
+
+	// a stall puts the schedule behind, the next queries are sent at once but keep their intended start
+	now = now.Add(time.Second)
+	intended, err := s.wait(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, start.Add(300*time.Millisecond), intended)
+	assert.Len(t, waits, 2)
+}
+
+func TestScheduleWithoutRate(t *testing.T) {
+	t.Parallel()
+	s := newSchedule(0, time.Now())
+	s.sleep = func(_ context.Context, _ time.Duration) error {
+		panic("this function should never be called in this test")
+	}
+
+	intended, err := s.wait(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, intended.IsZero())
+}
+
+func TestScheduleIsCancel(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := newSchedule(1, time.Now())
+	_, err := s.wait(ctx)
+	assert.NoError(t, err)
+	_, err = s.wait(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
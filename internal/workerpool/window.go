@@ -0,0 +1,54 @@
+package workerpool
+
+import (
+	"log"
+	"time"
+)
+
+// window splits a run into a warmup and a measurement of a fixed duration
+// Warmup queries are run like any other query but they are kept out of the metrics,
+// so cold caches and new connections do not distort them
+type window struct {
+	warmup        time.Duration
+	warmupQueries int
+	duration      time.Duration
+	now           func() time.Time
+
+	start     time.Time
+	sent      int
+	measuring time.Time
+}
+
+// newWindow creates a window starting at start, without warmup nor duration every query is measured until the input ends
+func newWindow(warmup time.Duration, warmupQueries int, duration time.Duration, start time.Time) *window {
+	return &window{warmup: warmup, warmupQueries: warmupQueries, duration: duration, now: time.Now, start: start}
+}
+
+// next returns whether the next query is a warmup query, or done once the measurement duration has passed
+// The warmup ends once both the warmup duration and the warmup queries are reached
+func (w *window) next() (warmup bool, done bool) {
+	now := w.now()
+	if w.measuring.IsZero() {
+		if now.Sub(w.start) < w.warmup || w.sent < w.warmupQueries {
+			w.sent++
+			return true, false
+		}
+		w.measuring = now
+		if w.sent > 0 {
+			log.Printf("warmup: done after %d queries and %v, measuring", w.sent, now.Sub(w.start).Round(time.Millisecond))
+		}
+	}
+
+	if w.duration > 0 && now.Sub(w.measuring) >= w.duration {
+		return false, true
+	}
+	return false, false
+}
+
+// measured returns when the measurement started, the start of the run when it never did
+func (w *window) measured() time.Time {
+	if w.measuring.IsZero() {
+		return w.start
+	}
+	return w.measuring
+}
@@ -0,0 +1,70 @@
+package workerpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowWithoutWarmupNorDuration(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	w := newWindow(0, 0, 0, start)
+	w.now = func() time.Time { return start.Add(time.Hour) }
+
+	for range 3 {
+		warmup, done := w.next()
+		assert.False(t, warmup)
+		assert.False(t, done)
+	}
+	assert.Equal(t, start.Add(time.Hour), w.measured())
+}
+
+func TestWindowWarmupQueriesThenDuration(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	w := newWindow(0, 2, 10*time.Second, start)
+	w.now = func() time.Time { return now }
+	assert.Equal(t, start, w.measured())
+
+	for range 2 {
+		warmup, done := w.next()
+		assert.True(t, warmup)
+		assert.False(t, done)
+		now = now.Add(time.Second)
+	}
+
+	// the duration is measured from the end of the warmup, not from the start of the run
+	warmup, done := w.next()
+	assert.False(t, warmup)
+	assert.False(t, done)
+	assert.Equal(t, start.Add(2*time.Second), w.measured())
+
+	now = start.Add(11 * time.Second)
+	_, done = w.next()
+	assert.False(t, done)
+	now = start.Add(12 * time.Second)
+	_, done = w.next()
+	assert.True(t, done)
+}
+
+func TestWindowWarmupEndsOnceBothAreReached(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	w := newWindow(5*time.Second, 1, 0, start)
+	w.now = func() time.Time { return now }
+
+	warmup, _ := w.next()
+	assert.True(t, warmup)
+	// the warmup query is sent but the warmup duration has not passed yet
+	warmup, _ = w.next()
+	assert.True(t, warmup)
+
+	now = start.Add(5 * time.Second)
+	warmup, done := w.next()
+	assert.False(t, warmup)
+	assert.False(t, done)
+}
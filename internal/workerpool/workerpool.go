@@ -2,9 +2,12 @@ package workerpool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/vrnvu/go-sql/internal/client"
@@ -15,20 +18,100 @@ import (
 const (
 	// MaxWorkers is the maximum number of parallel workers querying TigerData
 	MaxWorkers = 1024
+	// DefaultQueueDepth is the number of queries queued per worker, enough to keep a worker busy while the reader parses
+	DefaultQueueDepth = 16
+	// MaxQueueDepth bounds the memory of the queued queries
+	MaxQueueDepth = 4096
+	// DefaultGracePeriod is how long the queries in flight have to finish once the run is interrupted
+	DefaultGracePeriod = 10 * time.Second
 )
 
 // Result is a single query result, containing the worker ID, hostname, request start time, and request end time
-// Note: Simple representation, state can be Skipped, Failed or Successful(duration)
+// Note: Simple representation, state can be Skipped(reason), Failed or Successful(duration)
 type Result struct {
-	skipped  bool
-	failed   bool
-	Duration time.Duration
+	skipped   bool
+	reason    query.Reason
+	failed    bool
+	queryType query.QueryType
+	tags      map[string]string
+	hostname  string
+	Duration  time.Duration
+	// corrected is the latency from the intended start of the query, only set with a target rate
+	corrected time.Duration
+	warmup    bool
+}
+
+// task is a query sent to a worker with the time it was scheduled to start, zero when not scheduled
+// queued is the time it entered the queue, to measure the queue wait of the worker
+// warmup tasks are run but kept out of the metrics
+type task struct {
+	query    query.Query
+	intended time.Time
+	queued   time.Time
+	warmup   bool
+}
+
+// workerStats is the load of a single worker, only written by its worker so it needs no lock
+type workerStats struct {
+	hostnames map[string]struct{}
+	stolen    int
+	// tokens is the number of queries that took a rate limit token, throttled the ones that waited for it
+	tokens       int
+	throttled    int
+	throttleWait time.Duration
+	busy         time.Duration
+	queueWait    time.Duration
+	stopped      time.Time
+	latency      *metrics.Reservoir
+}
+
+// newWorkerStats keeps as many latency samples per worker as per group of a metrics.Breakdown
+func newWorkerStats() (*workerStats, error) {
+	latency, err := metrics.NewReservoirWithSize(metrics.BreakdownDefaultSampleSize, rand.Intn)
+	if err != nil {
+		return nil, err
+	}
+	return &workerStats{hostnames: make(map[string]struct{}), latency: latency}, nil
+}
+
+// add records a query of the worker that started at start
+func (s *workerStats) add(task task, start time.Time, response *client.Response, err error) {
+	s.busy += time.Since(start)
+	s.queueWait += start.Sub(task.queued)
+	s.hostnames[task.query.Hostname] = struct{}{}
+	if err != nil {
+		s.latency.AddFailed()
+		return
+	}
+	s.latency.AddResponse(response.Duration)
+}
+
+// addThrottle records the wait of a query for the rate limits
+func (s *workerStats) addThrottle(throttled time.Duration) {
+	s.tokens++
+	if throttled > 0 {
+		s.throttled++
+		s.throttleWait += throttled
+	}
+}
+
+// result is the load of the worker from the start of the measurement until it stopped
+func (s *workerStats) result(worker int, measured time.Time) metrics.WorkerResult {
+	return metrics.WorkerResult{
+		Worker:    worker,
+		Hostnames: len(s.hostnames),
+		Stolen:    s.stolen,
+		Throttled: s.throttled,
+		Busy:      s.busy,
+		Idle:      max(s.stopped.Sub(measured)-s.busy, 0),
+		QueueWait: s.queueWait,
+		Latency:   s.latency.Aggregate(),
+	}
 }
 
 // WorkerPool is a pool of workers that can execute queries
-// It maintains a map of hostnames to query channels, and a round-robin index for selecting the next worker
-// Strategy: fixed hostname to worker, or else round robin
-// For example:
+// Each worker reads from a bounded query channel, the Dispatcher of the pool picks the channel of each query
+// When the channel is full, reading waits for the worker, so memory stays flat regardless of the input size
 // For example: 4 cores, 4 workers, 4 query channels
 // We Map worker to Query channels:
 // queries = [chan string, chan string, chan string, chan string]
@@ -36,34 +119,64 @@ type Result struct {
 // - worker 1: query channel 1
 // - worker 2: query channel 2
 // - worker 3: query channel 3
-// When we receive a query, we map the hostname to the corresponding query channel or else round robin
-// Example:
-// query.hostname = "host1" -> query channel 0
-// query.hostname = "host3" -> query channel 2
-// query.hostname = "host2" -> query channel 1
-// query.hostname = "host1" -> query channel 0
-// query.hostname = "host2" -> query channel 1
-// query.hostname = "host3" -> query channel 2
-// query.hostname = "host4" -> query channel 3
-// query.hostname = "host5" -> query channel 0 // idx % numWorkers
+// The default strategy pins a hostname to a channel, see StrategySticky
+// With StrategyShared there is a single channel and every worker reads from it
+// With work stealing, an idle worker also takes queries from the fullest channel of another worker
 type WorkerPool struct {
 	client client.Client
 
-	queryReader         query.Reader
-	queries             []chan query.Query
-	wgQueries           sync.WaitGroup
-	results             chan Result
-	mapHostnameToWorker map[string]chan query.Query
-	lastWorkerIdx       int
-	numWorkers          int
-	wgWorkers           sync.WaitGroup
-
-	wgMetrics     sync.WaitGroup
-	simpleMetrics *metrics.Simple
+	queryReader query.Reader
+	queries     []chan task
+	results     chan Result
+	dispatcher  Dispatcher
+	numWorkers  int
+	wgWorkers   sync.WaitGroup
+	// workerStats are indexed by worker, read once every worker is done
+	workerStats []*workerStats
+
+	errorPolicy  ErrorPolicy
+	targetRate   float64
+	workStealing bool
+	// queued wakes up idle workers to steal when a task is queued, nil without work stealing
+	queued      chan struct{}
+	gracePeriod time.Duration
+	// window is only used by Run, see Options.Duration
+	window *window
+	// limiter caps the pool and workerLimiters each worker, nil without a limit
+	limiter        *limiter
+	workerLimiters []*limiter
+	maxRate        float64
+	maxWorkerRate  float64
+	// notDispatched counts the queries read from the input and never sent to the database
+	notDispatched atomic.Int64
+	// cancelled counts the queries in flight the pool cancelled, at the end of the grace period or when the breaker trips
+	cancelled atomic.Int64
+	// warmupQueries counts the warmup queries run, only written by the metrics collector
+	warmupQueries int
+	// breaker is checked by the metrics collector, it calls trip once to abort the run, see Run
+	breaker *breaker
+	trip    func(err error)
+	tripped bool
+	// onDone is Options.OnDone, see done
+	onDone func()
+
+	wgMetrics       sync.WaitGroup
+	responseMetrics *metrics.Reservoir
+	queueMetrics    *metrics.Queue
+	typeMetrics     *metrics.Breakdown
+	tagMetrics      *metrics.Breakdown
+	hostMetrics     *metrics.Breakdown
+	// correctedMetrics is only set with a target rate
+	correctedMetrics *metrics.Reservoir
 }
 
 // New creates a new WorkerPool with the given number of workers
 func New(numWorkers int, client client.Client, queryReader query.Reader) (*WorkerPool, error) {
+	return NewWithOptions(numWorkers, client, queryReader, Options{})
+}
+
+// NewWithOptions creates a new WorkerPool with the given number of workers and options
+func NewWithOptions(numWorkers int, client client.Client, queryReader query.Reader, options Options) (*WorkerPool, error) {
 	if numWorkers < 1 {
 		return nil, fmt.Errorf("number of workers must be greater than 0")
 	}
@@ -72,71 +185,218 @@ func New(numWorkers int, client client.Client, queryReader query.Reader) (*Worke
 		return nil, fmt.Errorf("number of workers must be less than %d", MaxWorkers)
 	}
 
-	queries := make([]chan query.Query, numWorkers)
-	for i := range numWorkers {
-		queries[i] = make(chan query.Query)
+	if err := options.ErrorPolicy.validate(); err != nil {
+		return nil, err
+	}
+
+	if err := options.CircuitBreaker.validate(); err != nil {
+		return nil, err
+	}
+
+	gracePeriod := options.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultGracePeriod
+	}
+	if gracePeriod < 0 {
+		return nil, fmt.Errorf("grace period %v must be greater than 0", gracePeriod)
+	}
+
+	if options.Warmup < 0 || options.WarmupQueries < 0 || options.Duration < 0 {
+		return nil, fmt.Errorf("warmup %v, warmup queries %d and duration %v must be greater or equal than 0", options.Warmup, options.WarmupQueries, options.Duration)
+	}
+
+	if options.TargetRate < 0 {
+		return nil, fmt.Errorf("target rate %v must be greater or equal than 0", options.TargetRate)
+	}
+
+	if options.MaxRate < 0 || options.MaxWorkerRate < 0 || options.RateLimitBurst < 0 {
+		return nil, fmt.Errorf("max rate %v, max worker rate %v and rate limit burst %d must be greater or equal than 0",
+			options.MaxRate, options.MaxWorkerRate, options.RateLimitBurst)
+	}
+	if options.TargetRate > 0 && (options.MaxRate > 0 || options.MaxWorkerRate > 0) {
+		return nil, fmt.Errorf("max rates cap closed loop runs, they can not be used with a target rate of %v", options.TargetRate)
+	}
+
+	dispatcher, err := NewDispatcher(options.Strategy, numWorkers)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.WorkStealing && dispatcher.Queues() == 1 {
+		return nil, fmt.Errorf("work stealing needs a queue per worker, strategy %q has a single queue", options.Strategy)
+	}
+
+	queueDepth := options.QueueDepth
+	if queueDepth == 0 {
+		queueDepth = DefaultQueueDepth
+	}
+	if queueDepth < 0 || queueDepth > MaxQueueDepth {
+		return nil, fmt.Errorf("queue depth %d must be between 1 and %d", queueDepth, MaxQueueDepth)
+	}
+	// workers sharing a queue share its capacity too
+	queueCapacity := queueDepth * numWorkers / dispatcher.Queues()
+
+	queries := make([]chan task, dispatcher.Queues())
+	for i := range queries {
+		queries[i] = make(chan task, queueCapacity)
+	}
+
+	stats := make([]*workerStats, numWorkers)
+	for i := range stats {
+		if stats[i], err = newWorkerStats(); err != nil {
+			return nil, err
+		}
+	}
+
+	workerLimiters := make([]*limiter, numWorkers)
+	for i := range workerLimiters {
+		workerLimiters[i] = newLimiter(options.MaxWorkerRate, options.RateLimitBurst)
+	}
+
+	hostMetrics, err := metrics.NewBreakdownWithLimit(metrics.HostDefaultSampleSize, metrics.HostDefaultMaxGroups, rand.Intn)
+	if err != nil {
+		return nil, err
+	}
+
+	var queued chan struct{}
+	if options.WorkStealing {
+		queued = make(chan struct{}, numWorkers)
+	}
+
+	var correctedMetrics *metrics.Reservoir
+	if options.TargetRate > 0 {
+		correctedMetrics = metrics.NewReservoir(rand.Intn)
 	}
 
 	return &WorkerPool{
-		queryReader:         queryReader,
-		client:              client,
-		simpleMetrics:       metrics.NewSimple(),
-		queries:             queries,
-		results:             make(chan Result),
-		mapHostnameToWorker: make(map[string]chan query.Query),
-		numWorkers:          numWorkers,
+		queryReader:     queryReader,
+		client:          client,
+		responseMetrics: metrics.NewReservoir(rand.Intn),
+		queueMetrics:    metrics.NewQueue(len(queries), queueCapacity),
+		typeMetrics:     metrics.NewBreakdown(rand.Intn),
+		tagMetrics:      metrics.NewBreakdown(rand.Intn),
+		hostMetrics:     hostMetrics,
+		queries:         queries,
+		results:         make(chan Result),
+		dispatcher:      dispatcher,
+		numWorkers:      numWorkers,
+		workerStats:     stats,
+		errorPolicy:     options.ErrorPolicy,
+		targetRate:      options.TargetRate,
+		workStealing:    options.WorkStealing,
+		queued:          queued,
+		window:          newWindow(options.Warmup, options.WarmupQueries, options.Duration, time.Time{}),
+		limiter:         newLimiter(options.MaxRate, options.RateLimitBurst),
+		workerLimiters:  workerLimiters,
+		maxRate:         options.MaxRate,
+		maxWorkerRate:   options.MaxWorkerRate,
+		breaker:         newBreaker(options.CircuitBreaker),
+		gracePeriod:     gracePeriod,
+		onDone:          options.OnDone,
+
+		correctedMetrics: correctedMetrics,
 	}, nil
 }
 
 // Run reads queries from the query reader and distributes them to the workers
 // It collects metrics from the results channel and returns the aggregated metrics
-// Returns error in panics and context cancellation
+// Returns ErrSkippedRows with the metrics of the queries already sent when the error policy aborts the run
+// Returns the context error with the metrics of the queries already run when the context is done, see interrupt
+// Returns ErrDatabaseUnhealthy with the metrics of the queries already run when the circuit breaker aborts the run,
+// the queued queries are dropped and the queries in flight cancelled right away
 // 1. it starts all the workers (numWorkers) and the metrics collector (1)
-// 2. it reads queries from the query reader and distributes them to the workers
+// 2. it reads queries from the query reader and queues them for the workers, waiting while the queue is full
+// With a target rate, query i is sent at its intended start, start + i/rate, regardless of how many are still running
+// With a duration, reading stops once the measurement after the warmup has run for it, see window
 // 3. it waits for all the workers to finish and closes the results channel
 // 4. it waits for the metrics collector to finish and returns the aggregated metrics
 func (wp *WorkerPool) Run(ctx context.Context) (metrics.Result, error) {
+	// workers outlive ctx for the grace period, so the queries in flight when it is done can finish
+	runCtx, cancelRun := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelRun()
+	// dispatchCtx is also cancelled by the circuit breaker, a database down will not answer within a grace period
+	dispatchCtx, abort := context.WithCancelCause(ctx)
+	defer abort(nil)
+	wp.trip = func(err error) {
+		log.Printf("circuit breaker: %v", err)
+		abort(err)
+		cancelRun()
+	}
+
 	for i := 0; i < wp.numWorkers; i++ {
 		wp.wgWorkers.Add(1)
-		go wp.worker(ctx, wp.queries[i])
+		go wp.worker(dispatchCtx, runCtx, i)
 	}
 
-	go wp.CollectMetrics()
+	wp.wgMetrics.Add(1)
+	go wp.collectMetrics()
+
+	// ctx may be done while the input is read or while the workers drain the queues once it is read
+	drained := make(chan struct{})
+	go wp.interrupt(ctx, drained, cancelRun)
 
+	start := time.Now()
+	schedule := newSchedule(wp.targetRate, start)
+	wp.window.start = start
+
+	var abortErr error
+	read, skipped := 0, 0
 	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("context done: %v", ctx.Err())
-			return metrics.Result{}, ctx.Err()
-		default:
+		if dispatchCtx.Err() != nil {
+			break
 		}
 
-		query, hasMore, err := wp.queryReader.Next()
+		q, hasMore, err := wp.queryReader.Next()
+		// readers may return an error ending the input, e.g. a malformed last row, it is skipped like any other row
+		if err != nil {
+			read++
+			skipped++
+			log.Printf("warning: skipped reading query due to error: %v", err)
+			wp.sendSkipped(query.ReasonOf(err))
+			if abortErr = wp.errorPolicy.check(skipped, read, !hasMore, err); abortErr != nil {
+				log.Printf("error policy: %v", abortErr)
+				break
+			}
+		}
 		if !hasMore {
 			log.Printf("no more queries")
+			abortErr = wp.errorPolicy.check(skipped, read, true, err)
 			break
 		}
 		if err != nil {
-			log.Printf("warning: skipped reading query due to error: %v", err)
-			wp.sendSkipped(ctx)
 			continue
 		}
+		read++
 
-		queryChan := wp.getWorker(query.Hostname)
-		wp.wgQueries.Add(1)
-		go wp.sendQuery(ctx, queryChan, query)
+		intended, err := schedule.wait(dispatchCtx)
+		if err != nil {
+			wp.notDispatched.Add(1)
+			wp.release()
+			break
+		}
+		warmup, done := wp.window.next()
+		if done {
+			log.Printf("measurement duration of %v is over", wp.window.duration)
+			wp.release()
+			break
+		}
+		queue := wp.dispatcher.Dispatch(q)
+		if err := wp.sendQuery(dispatchCtx, wp.queries[queue], task{query: q, intended: intended, warmup: warmup}); err != nil {
+			wp.notDispatched.Add(1)
+			wp.done(queue)
+			break
+		}
 	}
 
-	// wait for all the queries to be sent to the workers
-	wp.wgQueries.Wait()
-
-	// close the query channels after all the queries are sent to the workers
-	for i := 0; i < wp.numWorkers; i++ {
-		close(wp.queries[i])
+	// close the query channels after all the queries are queued, workers run the queued queries and stop
+	for _, queryChan := range wp.queries {
+		close(queryChan)
 	}
 
 	// wait for all the workers to process all the queries
 	wp.wgWorkers.Wait()
+	close(drained)
+	interrupted := ctx.Err() != nil
 
 	// close the results channel after all the workers have processed all the queries
 	close(wp.results)
@@ -144,95 +404,315 @@ func (wp *WorkerPool) Run(ctx context.Context) (metrics.Result, error) {
 	// wait for the metrics collector to finish collecting metrics from results
 	wp.wgMetrics.Wait()
 
-	return wp.simpleMetrics.Aggregate(), nil
-}
+	// the breaker may also trip while the queued queries run, after the input is read
+	var unhealthyErr error
+	if cause := context.Cause(dispatchCtx); errors.Is(cause, ErrDatabaseUnhealthy) {
+		unhealthyErr = cause
+	}
 
-func (wp *WorkerPool) sendQuery(ctx context.Context, queryChan chan query.Query, query query.Query) {
-	defer func() {
-		wp.wgQueries.Done()
-	}()
+	result := wp.responseMetrics.Aggregate()
+	result.ByQueryType = wp.typeMetrics.Aggregate()
+	result.ByTag = wp.tagMetrics.Aggregate()
+	result.ByHost = wp.hostMetrics.Aggregate()
+	result.UntrackedHostQueries = wp.hostMetrics.Untracked()
+	result.WarmupQueries = wp.warmupQueries
+	result.Queue = wp.queueMetrics.Aggregate()
+	result.Workers = make([]metrics.WorkerResult, len(wp.workerStats))
+	for i, stats := range wp.workerStats {
+		result.Workers[i] = stats.result(i, wp.window.measured())
+		result.Queue.Stolen += stats.stolen
+	}
+	result.Queue.WorkStealing = wp.workStealing
+	if wp.maxRate > 0 || wp.maxWorkerRate > 0 {
+		result.Throttle = &metrics.ThrottleResult{MaxRate: wp.maxRate, MaxWorkerRate: wp.maxWorkerRate}
+		for _, stats := range wp.workerStats {
+			result.Throttle.Queries += stats.tokens
+			result.Throttle.Throttled += stats.throttled
+			result.Throttle.WaitTime += stats.throttleWait
+		}
+	}
+	if wp.correctedMetrics != nil {
+		corrected := wp.correctedMetrics.Aggregate()
+		result.Corrected = &corrected
+	}
 
-	select {
-	case <-ctx.Done():
-		return
-	case queryChan <- query:
+	switch {
+	case interrupted:
+		result.Status = metrics.StatusInterrupted
+		result.NotDispatched = int(wp.notDispatched.Load())
+		result.Cancelled = int(wp.cancelled.Load())
+		return result, ctx.Err()
+	case unhealthyErr != nil:
+		result.Status = metrics.StatusAborted
+		result.AbortReason = unhealthyErr.Error()
+		result.NotDispatched = int(wp.notDispatched.Load())
+		result.Cancelled = int(wp.cancelled.Load())
+		return result, unhealthyErr
+	case abortErr != nil:
+		result.Status = metrics.StatusAborted
+		result.AbortReason = abortErr.Error()
+		return result, abortErr
+	default:
+		result.Status = metrics.StatusCompleted
+		return result, nil
 	}
 }
 
-func (wp *WorkerPool) sendResult(ctx context.Context, result Result) {
+// interrupt stops the run once the context is done: the queued queries are dropped and counted as not dispatched,
+// the queries in flight have the grace period to finish before their context is cancelled
+// It returns once drained is closed, when every worker is done
+func (wp *WorkerPool) interrupt(ctx context.Context, drained <-chan struct{}, cancelRun context.CancelFunc) {
 	select {
-	case <-ctx.Done():
+	case <-drained:
 		return
-	case wp.results <- result:
+	case <-ctx.Done():
 	}
-}
 
-func (wp *WorkerPool) sendSkipped(ctx context.Context) {
+	log.Printf("interrupted: waiting up to %v for the queries in flight", wp.gracePeriod)
+	timer := time.NewTimer(wp.gracePeriod)
+	defer timer.Stop()
 	select {
-	case <-ctx.Done():
-		return
-	case wp.results <- Result{skipped: true}:
+	case <-drained:
+	case <-timer.C:
+		log.Printf("interrupted: grace period of %v is over, cancelling the queries in flight", wp.gracePeriod)
+		cancelRun()
 	}
 }
 
-func (wp *WorkerPool) sendFailed(ctx context.Context) {
+// sendQuery queues the task, waiting for room when the queue is full: the backpressure on the reader
+func (wp *WorkerPool) sendQuery(ctx context.Context, queryChan chan task, task task) error {
+	depth := len(queryChan)
+	task.queued = time.Now()
+	select {
+	case queryChan <- task:
+		wp.addDispatch(task, depth, 0)
+		return nil
+	default:
+	}
+
+	start := time.Now()
 	select {
 	case <-ctx.Done():
-		return
-	case wp.results <- Result{failed: true}:
+		return ctx.Err()
+	case queryChan <- task:
+		wp.addDispatch(task, depth, time.Since(start))
+		return nil
 	}
 }
 
-func (wp *WorkerPool) worker(ctx context.Context, queries <-chan query.Query) {
+// addDispatch records the queue metrics of the task, warmup tasks are not measured
+// With work stealing it wakes up an idle worker, the signal is dropped when every worker already has one pending
+func (wp *WorkerPool) addDispatch(task task, depth int, wait time.Duration) {
+	if !task.warmup {
+		wp.queueMetrics.AddDispatch(depth, wait)
+	}
+	if wp.queued != nil {
+		select {
+		case wp.queued <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sendResult, sendSkipped and sendFailed do not give up when the run is interrupted,
+// the metrics collector reads results until every worker is done so partial results are complete
+func (wp *WorkerPool) sendResult(result Result) {
+	wp.results <- result
+}
+
+func (wp *WorkerPool) sendSkipped(reason query.Reason) {
+	wp.results <- Result{skipped: true, reason: reason}
+}
+
+func (wp *WorkerPool) sendFailed(query query.Query, warmup bool) {
+	wp.results <- Result{failed: true, queryType: query.QueryType(), tags: query.Tags, hostname: query.Hostname, warmup: warmup}
+}
+
+// worker runs the queries of its queue with runCtx until the queue is closed
+// Once ctx is done, the queued queries are dropped and counted as not dispatched, the queue is drained until it is closed
+// Worker id reads queue id%queues and records its load in workerStats[id]
+func (wp *WorkerPool) worker(ctx context.Context, runCtx context.Context, id int) {
 	defer wp.wgWorkers.Done()
+	queue := id % len(wp.queries)
+	stats := wp.workerStats[id]
+
+	defer func() {
+		stats.stopped = time.Now()
+	}()
 
 	for {
-		select {
-		case <-ctx.Done():
+		task, from, ok := wp.nextTask(queue)
+		if !ok {
 			return
-		case query, ok := <-queries:
-			if !ok {
-				return
-			}
+		}
+		// warmup tasks are not counted as dispatched either, see addDispatch
+		if from != queue && !task.warmup {
+			stats.stolen++
+		}
+		if ctx.Err() != nil {
+			wp.done(from)
+			wp.notDispatched.Add(1)
+			continue
+		}
 
-			response, err := wp.client.Query(ctx, query.Build())
-			if err != nil {
-				log.Printf("worker: failed query: %v", err)
-				wp.sendFailed(ctx)
-				continue
-			}
+		throttled, err := wp.throttle(runCtx, id)
+		if err != nil {
+			wp.done(from)
+			wp.notDispatched.Add(1)
+			continue
+		}
+		if !task.warmup {
+			stats.addThrottle(throttled)
+		}
 
-			wp.sendResult(ctx, Result{Duration: response.Duration})
+		query := task.query
+		start := time.Now()
+		response, err := wp.client.Query(runCtx, query.Build())
+		wp.done(from)
+		// runCtx is only cancelled by the pool, the query did not fail on its own and would skew the failures of each host
+		if err != nil && runCtx.Err() != nil {
+			wp.cancelled.Add(1)
+			continue
+		}
+		if !task.warmup {
+			stats.add(task, start, response, err)
 		}
+		if err != nil {
+			log.Printf("worker: failed query: %v", err)
+			wp.sendFailed(query, task.warmup)
+			continue
+		}
+
+		result := Result{Duration: response.Duration, queryType: query.QueryType(), tags: query.Tags, hostname: query.Hostname, warmup: task.warmup}
+		if !task.intended.IsZero() {
+			result.corrected = time.Since(task.intended)
+		}
+		wp.sendResult(result)
 	}
 }
 
-// getWorker returns the query channel for the given hostname
-// If the hostname is not mapped, it uses round robin
-func (wp *WorkerPool) getWorker(hostname string) chan query.Query {
-	if queryChan, exists := wp.mapHostnameToWorker[hostname]; exists {
-		return queryChan
+// done is called once the worker is done with a task of the queue, run or dropped
+func (wp *WorkerPool) done(queue int) {
+	wp.dispatcher.Done(queue)
+	wp.release()
+}
+
+// release calls Options.OnDone for a query read from the input
+func (wp *WorkerPool) release() {
+	if wp.onDone != nil {
+		wp.onDone()
 	}
+}
 
-	queryChan := wp.queries[wp.lastWorkerIdx]
-	wp.mapHostnameToWorker[hostname] = queryChan
-	wp.lastWorkerIdx = (wp.lastWorkerIdx + 1) % wp.numWorkers
-	return queryChan
+// throttle waits for a token of the worker rate limit, then of the pool rate limit, and returns how long it waited
+// The worker token is taken first so a worker over its own limit does not hold a token of the pool
+func (wp *WorkerPool) throttle(runCtx context.Context, id int) (time.Duration, error) {
+	workerWait, err := wp.workerLimiters[id].wait(runCtx)
+	if err != nil {
+		return workerWait, err
+	}
+	poolWait, err := wp.limiter.wait(runCtx)
+	return workerWait + poolWait, err
 }
 
-// CollectMetrics collects results from the results channel and updates metrics
+// nextTask returns the next task of the worker and the queue it was taken from, false once there are no more tasks
+// With work stealing, a worker whose queue is empty steals before it waits, and again every time a task is queued
+// Workers stop once their queue is closed, not when runCtx is done: a reader waiting for queries to be done, e.g. a ramp
+// step, would wait forever for the queued queries, see Options.OnDone
+func (wp *WorkerPool) nextTask(queue int) (task, int, bool) {
+	queries := wp.queries[queue]
+	for {
+		if wp.workStealing && len(queries) == 0 {
+			if task, from, ok := wp.steal(queue); ok {
+				return task, from, true
+			}
+		}
+
+		// without work stealing queued is nil, it never fires and the worker only waits for its queue
+		select {
+		case task, ok := <-queries:
+			if ok {
+				return task, queue, true
+			}
+			// the queues are closed together once the input is read, an idle worker helps drain the others before it stops
+			if wp.workStealing {
+				return wp.steal(queue)
+			}
+			return task, 0, false
+		case <-wp.queued:
+		}
+	}
+}
+
+// steal takes a queued task from the fullest queue other than the given one, false when every other queue is empty
+// The hostnames of a sticky queue stay on its worker unless it falls behind, so most of the locality is kept
+func (wp *WorkerPool) steal(queue int) (task, int, bool) {
+	for {
+		victim, depth := -1, 0
+		for i, queries := range wp.queries {
+			if i != queue && len(queries) > depth {
+				victim, depth = i, len(queries)
+			}
+		}
+		if victim < 0 {
+			return task{}, 0, false
+		}
+
+		select {
+		case task, ok := <-wp.queries[victim]:
+			if ok {
+				return task, victim, true
+			}
+		default:
+		}
+		// another worker emptied the queue first, look again
+	}
+}
+
+// collectMetrics collects results from the results channel and updates metrics
 // Since this is unbounded, acts a sync mechanism, we could have multiple metrics collectors
 // Then we would need to make our metrics thread safe
-func (wp *WorkerPool) CollectMetrics() {
-	wp.wgMetrics.Add(1)
+// The caller adds it to wgMetrics before starting it, so Run can not wait before it starts
+func (wp *WorkerPool) collectMetrics() {
 	defer wp.wgMetrics.Done()
 	for result := range wp.results {
+		if !result.skipped && !wp.tripped {
+			if err := wp.breaker.record(result.failed); err != nil {
+				wp.tripped = true
+				wp.trip(err)
+			}
+		}
+		if result.warmup {
+			wp.warmupQueries++
+			continue
+		}
 		if result.skipped {
-			wp.simpleMetrics.AddSkipped()
+			wp.responseMetrics.AddSkippedWithReason(string(result.reason))
 		} else if result.failed {
-			wp.simpleMetrics.AddFailed()
+			wp.responseMetrics.AddFailed()
+			if wp.correctedMetrics != nil {
+				wp.correctedMetrics.AddFailed()
+			}
+			wp.typeMetrics.AddFailed(string(result.queryType))
+			for name, value := range result.tags {
+				wp.tagMetrics.AddFailed(name + "=" + value)
+			}
+			if result.hostname != "" {
+				wp.hostMetrics.AddFailed(result.hostname)
+			}
 		} else {
-			wp.simpleMetrics.AddResponse(result.Duration)
+			wp.responseMetrics.AddResponse(result.Duration)
+			if wp.correctedMetrics != nil {
+				wp.correctedMetrics.AddResponse(result.corrected)
+			}
+			wp.typeMetrics.AddResponse(string(result.queryType), result.Duration)
+			for name, value := range result.tags {
+				wp.tagMetrics.AddResponse(name+"="+value, result.Duration)
+			}
+			// multi host queries are counted under the hostname of their row, templates without a hostname are not counted
+			if result.hostname != "" {
+				wp.hostMetrics.AddResponse(result.hostname, result.Duration)
+			}
 		}
 	}
 }
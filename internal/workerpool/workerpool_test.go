@@ -4,14 +4,17 @@ import (
 	"context"
 	"encoding/csv"
 	"fmt"
+	"math"
 	"math/rand"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gkampitakis/go-snaps/snaps"
 	"github.com/stretchr/testify/assert"
 	"github.com/vrnvu/go-sql/internal/client"
+	"github.com/vrnvu/go-sql/internal/metrics"
 	"github.com/vrnvu/go-sql/internal/query"
 	"pgregory.net/rapid"
 )
@@ -114,6 +117,11 @@ func TestSnapshot(t *testing.T) {
 		metrics, err := wp.Run(ctx)
 		assert.NoError(t, err)
 		assert.NotNil(t, metrics)
+
+		// queue depths depend on how the workers are scheduled, the rest of the metrics do not
+		assert.Equal(t, numWorkers, metrics.Queue.Queues)
+		assert.Equal(t, DefaultQueueDepth, metrics.Queue.Capacity)
+		metrics.Queue = nil
 		snaps.MatchSnapshot(t, metrics.Table())
 	})
 }
@@ -157,26 +165,714 @@ func TestWorkerPoolProcessesAllQueries(t *testing.T) {
 	})
 }
 
-func TestWorkerPoolMapsHostnameToWorker(t *testing.T) {
-	if testing.Short() {
-		t.Skip("slow: workerpool snapshot")
+func TestWorkerPoolCountsSkippedReasons(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time\n" +
+		"host1,2023-01-01 10:00:00,2023-01-01 10:01:00\n" +
+		"host2,2023-01-01 10:01:00,2023-01-01 10:00:00\n" +
+		"host3,INVALID,2023-01-01 10:01:00\n" +
+		"host4,2023-01-01 10:01:00,2023-01-01 10:00:00\n"
+
+	options := query.Options{Validation: query.Validation{StartBeforeEnd: true}}
+	queryReader, err := query.NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	wp, err := New(2, &testDeterministicClient{}, queryReader)
+	assert.NoError(t, err)
+
+	metrics, err := wp.Run(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, metrics.NumberOfQueries)
+	assert.Equal(t, 3, metrics.SkippedQueries)
+	assert.Equal(t, map[string]int{
+		string(query.ReasonStartAfterEnd): 2,
+		string(query.ReasonInvalidValue):  1,
+	}, metrics.SkippedReasons)
+}
+
+func TestWorkerPoolBreaksDownQueryTypes(t *testing.T) {
+	t.Parallel()
+	mix, err := query.ParseMix("single-host=1,max-per-minute=1,lastpoint=1")
+	assert.NoError(t, err)
+
+	spec := query.DefaultGeneratorSpec()
+	spec.Count = 300
+	generator, err := query.NewGenerator(spec)
+	assert.NoError(t, err)
+	reader, err := query.NewMixReader(generator, mix, 1, 4)
+	assert.NoError(t, err)
+
+	wp, err := New(4, &testDeterministicClient{}, reader)
+	assert.NoError(t, err)
+
+	metrics, err := wp.Run(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 300, metrics.NumberOfQueries)
+	assert.Len(t, metrics.ByQueryType, 3)
+
+	numberOfQueries := 0
+	for _, result := range metrics.ByQueryType {
+		numberOfQueries += result.NumberOfQueries
+		assert.Equal(t, 1*time.Second, result.MedianResponse)
+	}
+	assert.Equal(t, 300, numberOfQueries)
+}
+
+// testCSVReader returns a reader of numRows rows, where every row in invalidRows has an invalid start_time
+func testCSVReader(t *testing.T, numRows int, invalidRows map[int]bool) query.Reader {
+	csvContent := "hostname,start_time,end_time\n"
+	for i := range numRows {
+		startTime := "2023-01-01 10:00:00"
+		if invalidRows[i] {
+			startTime = "INVALID"
+		}
+		csvContent += fmt.Sprintf("host%d,%s,2023-01-01 10:01:00\n", i%10, startTime)
+	}
+
+	queryReader, err := query.NewQueryReader(csv.NewReader(strings.NewReader(csvContent)))
+	assert.NoError(t, err)
+	return queryReader
+}
+
+func TestWorkerPoolErrorPolicy(t *testing.T) {
+	t.Parallel()
+	invalidRows := map[int]bool{50: true, 150: true, 151: true, 152: true}
+	for _, tc := range []struct {
+		name            string
+		policy          ErrorPolicy
+		numRows         int
+		numberOfQueries int
+		skippedQueries  int
+		aborted         bool
+	}{
+		{name: "lenient", policy: ErrorPolicy{}, numRows: 200, numberOfQueries: 196, skippedQueries: 4},
+		{name: "strict", policy: ErrorPolicy{Mode: ErrorStrict}, numRows: 200, numberOfQueries: 50, skippedQueries: 1, aborted: true},
+		{name: "max skipped", policy: ErrorPolicy{Mode: ErrorThreshold, MaxSkipped: 2}, numRows: 200, numberOfQueries: 149, skippedQueries: 3, aborted: true},
+		{name: "max skipped not reached", policy: ErrorPolicy{Mode: ErrorThreshold, MaxSkipped: 4}, numRows: 200, numberOfQueries: 196, skippedQueries: 4},
+		// 1 of 51 rows is over the ratio, but it is not checked before 100 rows are read
+		{name: "max skipped ratio", policy: ErrorPolicy{Mode: ErrorThreshold, MaxSkippedRatio: 0.015}, numRows: 200, numberOfQueries: 149, skippedQueries: 3, aborted: true},
+		// inputs shorter than 100 rows are checked at the end
+		{name: "max skipped ratio at the end", policy: ErrorPolicy{Mode: ErrorThreshold, MaxSkippedRatio: 0.01}, numRows: 60, numberOfQueries: 59, skippedQueries: 1, aborted: true},
+		{name: "max skipped ratio not reached", policy: ErrorPolicy{Mode: ErrorThreshold, MaxSkippedRatio: 0.03}, numRows: 200, numberOfQueries: 196, skippedQueries: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			options := Options{ErrorPolicy: tc.policy}
+			wp, err := NewWithOptions(4, &testDeterministicClient{}, testCSVReader(t, tc.numRows, invalidRows), options)
+			assert.NoError(t, err)
+
+			metrics, err := wp.Run(t.Context())
+			if tc.aborted {
+				assert.ErrorIs(t, err, ErrSkippedRows)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.numberOfQueries, metrics.NumberOfQueries)
+			assert.Equal(t, tc.skippedQueries, metrics.SkippedQueries)
+		})
+	}
+}
+
+func TestWorkerPoolErrorPolicyErrorsSnapshot(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(1, &testDeterministicClient{}, testCSVReader(t, 3, map[int]bool{0: true}), Options{ErrorPolicy: ErrorPolicy{Mode: ErrorStrict}})
+	assert.NoError(t, err)
+	metrics, err := wp.Run(t.Context())
+	assert.ErrorIs(t, err, ErrSkippedRows)
+	assert.Equal(t, 0, metrics.NumberOfQueries)
+	snaps.MatchSnapshot(t, err.Error())
+
+	for _, policy := range []ErrorPolicy{
+		{Mode: "panic"},
+		{Mode: ErrorThreshold},
+		{Mode: ErrorThreshold, MaxSkippedRatio: 2},
+	} {
+		_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{}, Options{ErrorPolicy: policy})
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+// A malformed last row ends the input with an error, it must still be counted
+func TestWorkerPoolCountsErrorEndingInput(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time\n" +
+		"host1,2023-01-01 10:00:00,2023-01-01 10:01:00\n" +
+		"host2,\"2023-01-01 10:00:00,2023-01-01 10:01:00\n"
+	queryReader, err := query.NewQueryReader(csv.NewReader(strings.NewReader(csvContent)))
+	assert.NoError(t, err)
+
+	wp, err := NewWithOptions(1, &testDeterministicClient{}, queryReader, Options{ErrorPolicy: ErrorPolicy{Mode: ErrorStrict}})
+	assert.NoError(t, err)
+	metrics, err := wp.Run(t.Context())
+	assert.ErrorIs(t, err, ErrSkippedRows)
+	assert.Equal(t, 1, metrics.NumberOfQueries)
+	assert.Equal(t, map[string]int{string(query.ReasonMalformedRow): 1}, metrics.SkippedReasons)
+}
+
+func TestWorkerPoolBreaksDownTags(t *testing.T) {
+	t.Parallel()
+	csvContent := "hostname,start_time,end_time,dashboard,window\n" +
+		"host1,2023-01-01 10:00:00,2023-01-01 11:00:00,ops,1h\n" +
+		"host2,2023-01-01 10:00:00,2023-01-01 11:00:00,ops,1h\n" +
+		"host3,2023-01-01 10:00:00,2023-01-01 10:01:00,billing,1m\n" +
+		"host4,2023-01-01 10:00:00,2023-01-01 10:01:00,,1m\n"
+	options := query.Options{TagColumns: []string{"dashboard", "window"}}
+	queryReader, err := query.NewQueryReaderWithOptions(csv.NewReader(strings.NewReader(csvContent)), options)
+	assert.NoError(t, err)
+
+	wp, err := New(2, &testDeterministicClient{}, queryReader)
+	assert.NoError(t, err)
+
+	metrics, err := wp.Run(t.Context())
+	assert.NoError(t, err)
+	assert.Equal(t, 4, metrics.NumberOfQueries)
+
+	numberOfQueries := make(map[string]int)
+	for tag, result := range metrics.ByTag {
+		numberOfQueries[tag] = result.NumberOfQueries
 	}
+	assert.Equal(t, map[string]int{"dashboard=ops": 2, "dashboard=billing": 1, "window=1h": 2, "window=1m": 2}, numberOfQueries)
+}
+
+// testSlowClient answers every query after a fixed delay, like a database slower than the target rate
+type testSlowClient struct {
+	delay time.Duration
+}
+
+func (t *testSlowClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testSlowClient) Query(_ context.Context, _ string) (*client.Response, error) {
+	time.Sleep(t.delay)
+	return &client.Response{Duration: t.delay}, nil
+}
+
+func TestWorkerPoolTargetRateCorrectsLatency(t *testing.T) {
+	t.Parallel()
+	// one worker running 20ms queries can not keep up with a query every 10ms, so queries wait for the worker
+	wp, err := NewWithOptions(1, &testSlowClient{delay: 20 * time.Millisecond}, &testQueryReader{maxCalls: 20}, Options{TargetRate: 100})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 20, result.NumberOfQueries)
+	assert.Equal(t, 20*time.Millisecond, result.MaxResponse)
+
+	// the last query is intended at 190ms and finishes after 400ms
+	assert.NotNil(t, result.Corrected)
+	assert.Equal(t, 20, result.Corrected.NumberOfQueries)
+	assert.Greater(t, result.Corrected.MaxResponse, 150*time.Millisecond)
+	assert.Greater(t, result.Corrected.P99Response, result.P99Response)
+}
+
+func TestWorkerPoolWithoutTargetRateIsNotCorrected(t *testing.T) {
+	t.Parallel()
+	wp, err := New(4, &testDeterministicClient{}, &testQueryReader{maxCalls: 10})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, result.Corrected)
+}
+
+func TestNewNegativeTargetRate(t *testing.T) {
+	t.Parallel()
+	_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{maxCalls: 10}, Options{TargetRate: -1})
+	assert.EqualError(t, err, "target rate -1 must be greater or equal than 0")
+}
+
+// testBlockingClient blocks every query until release is closed
+type testBlockingClient struct {
+	release chan struct{}
+}
+
+func (t *testBlockingClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testBlockingClient) Query(_ context.Context, _ string) (*client.Response, error) {
+	<-t.release
+	return &client.Response{Duration: time.Millisecond}, nil
+}
+
+// testCountingReader counts the calls to Next, safe to read while the pool runs
+type testCountingReader struct {
+	reader query.Reader
+	calls  atomic.Int64
+}
+
+func (t *testCountingReader) Next() (query.Query, bool, error) {
+	t.calls.Add(1)
+	return t.reader.Next()
+}
+
+func TestWorkerPoolQueueBackpressure(t *testing.T) {
+	t.Parallel()
+	reader := &testCountingReader{reader: &testQueryReader{maxCalls: 1000}}
+	blockingClient := &testBlockingClient{release: make(chan struct{})}
+	wp, err := NewWithOptions(2, blockingClient, reader, Options{QueueDepth: 3, Strategy: StrategyRoundRobin})
+	assert.NoError(t, err)
+
+	done := make(chan metrics.Result)
+	go func() {
+		result, err := wp.Run(context.Background())
+		assert.NoError(t, err)
+		done <- result
+	}()
+
+	// both workers hold a query, both queues are full and the reader waits for room
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(2+2*3+1), reader.calls.Load())
+
+	close(blockingClient.release)
+	result := <-done
+	assert.Equal(t, 1000, result.NumberOfQueries)
+	assert.Equal(t, 2, result.Queue.Queues)
+	assert.Equal(t, 3, result.Queue.Capacity)
+	assert.Equal(t, 3, result.Queue.MaxDepth)
+	assert.Positive(t, result.Queue.Waits)
+}
+
+func TestWorkerPoolSharedQueueCapacity(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(4, &testDeterministicClient{}, &testQueryReader{maxCalls: 10}, Options{QueueDepth: 2, Strategy: StrategyShared})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &metrics.QueueResult{Queues: 1, Capacity: 8}, &metrics.QueueResult{Queues: result.Queue.Queues, Capacity: result.Queue.Capacity})
+}
+
+func TestNewInvalidQueueDepth(t *testing.T) {
+	t.Parallel()
+	for _, depth := range []int{-1, MaxQueueDepth + 1} {
+		_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{maxCalls: 10}, Options{QueueDepth: depth})
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+// testContextClient blocks every query until its context is done
+type testContextClient struct{}
+
+func (t *testContextClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testContextClient) Query(ctx context.Context, _ string) (*client.Response, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// testDelayClient answers the nth query after delays[n], cycling through delays, unless its context is done first
+type testDelayClient struct {
+	delays []time.Duration
+	calls  atomic.Int64
+}
+
+func (t *testDelayClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testDelayClient) Query(ctx context.Context, _ string) (*client.Response, error) {
+	delay := t.delays[int(t.calls.Add(1)-1)%len(t.delays)]
+	select {
+	case <-time.After(delay):
+		return &client.Response{Duration: delay}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestWorkerPoolInterruptDrainsInFlightQueries(t *testing.T) {
+	t.Parallel()
+	reader := &testCountingReader{reader: &testQueryReader{maxCalls: 1000}}
+	// one query in flight finishes within the grace period, the other one is cancelled at the end of it
+	delayClient := &testDelayClient{delays: []time.Duration{100 * time.Millisecond, time.Hour}}
+	wp, err := NewWithOptions(2, delayClient, reader, Options{QueueDepth: 3, Strategy: StrategyRoundRobin, GracePeriod: 200 * time.Millisecond})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan metrics.Result)
+	go func() {
+		result, err := wp.Run(ctx)
+		assert.ErrorIs(t, err, context.Canceled)
+		done <- result
+	}()
+
+	// both workers hold a query and both queues are full when the run is interrupted
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	cancel()
+
+	result := <-done
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, metrics.StatusInterrupted, result.Status)
+	assert.Equal(t, 1, result.NumberOfQueries)
+	assert.Equal(t, 0, result.FailedQueries)
+	assert.Equal(t, 1, result.Cancelled)
+	// the queued queries and the query waiting for room in a queue
+	assert.Equal(t, 2*3+1, result.NotDispatched)
+	assert.Equal(t, int64(2+2*3+1), reader.calls.Load())
+	// queue waits depend on how the workers are scheduled, and the host of each delay on which worker queries first
+	result.Queue = nil
+	result.ByHost = nil
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+func TestWorkerPoolInterruptAfterInputIsRead(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(2, &testContextClient{}, &testQueryReader{maxCalls: 4}, Options{QueueDepth: 3, Strategy: StrategyRoundRobin, GracePeriod: 50 * time.Millisecond})
+	assert.NoError(t, err)
+
+	// the whole input is queued long before the run is interrupted
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err := wp.Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, metrics.StatusInterrupted, result.Status)
+	assert.Equal(t, 2, result.Cancelled)
+	assert.Equal(t, 2, result.NotDispatched)
+}
+
+func TestWorkerPoolInterruptCancelsAfterGracePeriod(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(2, &testContextClient{}, &testQueryReader{maxCalls: 1000}, Options{QueueDepth: 1, GracePeriod: 50 * time.Millisecond})
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	result, err := wp.Run(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, metrics.StatusInterrupted, result.Status)
+	// the queries in flight at the end of the grace period are cancelled, they did not fail
+	assert.Equal(t, 0, result.NumberOfQueries)
+	assert.Equal(t, 0, result.FailedQueries)
+	assert.Equal(t, 2, result.Cancelled)
+}
+
+func TestNewGracePeriod(t *testing.T) {
+	t.Parallel()
+	wp, err := New(2, &testDeterministicClient{}, &testQueryReader{})
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultGracePeriod, wp.gracePeriod)
+
+	wp, err = NewWithOptions(2, &testDeterministicClient{}, &testQueryReader{}, Options{GracePeriod: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wp.gracePeriod)
+}
+
+func TestWorkerPoolCompletedStatus(t *testing.T) {
 	t.Parallel()
 	wp, err := New(2, &testDeterministicClient{}, &testQueryReader{maxCalls: 10})
 	assert.NoError(t, err)
-	assert.NotNil(t, wp)
 
-	hostname1 := "host1"
-	hostname2 := "host2"
-	worker1 := wp.getWorker(hostname1)
-	rapid.Check(t, func(t *rapid.T) {
-		numWorkers := rapid.IntRange(1, MaxWorkers).Draw(t, "numWorkers")
-		for range numWorkers {
-			worker2 := wp.getWorker(hostname1)
-			assert.Equal(t, worker1, worker2)
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.StatusCompleted, result.Status)
+	assert.Equal(t, 0, result.NotDispatched)
+}
+
+func TestWorkerPoolWorkerStats(t *testing.T) {
+	t.Parallel()
+	// every hostname is queried twice, sticky dispatch keeps both queries on the same worker
+	reader := &testRepeatReader{reader: &testQueryReader{maxCalls: 20}, times: 2}
+	wp, err := NewWithOptions(4, &testDeterministicClient{}, reader, Options{Strategy: StrategySticky})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, result.Workers, 4)
+
+	queries, hostnames := 0, 0
+	for i, worker := range result.Workers {
+		assert.Equal(t, i, worker.Worker)
+		assert.Equal(t, 2*worker.Hostnames, worker.Latency.NumberOfQueries)
+		assert.GreaterOrEqual(t, worker.Busy+worker.Idle, worker.Busy)
+		queries += worker.Latency.NumberOfQueries
+		hostnames += worker.Hostnames
+	}
+	assert.Equal(t, 40, queries)
+	assert.Equal(t, 20, hostnames)
+}
+
+// testRepeatReader returns every query of reader the given number of times in a row
+type testRepeatReader struct {
+	reader  query.Reader
+	times   int
+	current query.Query
+	left    int
+}
+
+func (t *testRepeatReader) Next() (query.Query, bool, error) {
+	if t.left == 0 {
+		q, hasMore, err := t.reader.Next()
+		if err != nil || !hasMore {
+			return q, hasMore, err
 		}
-	})
+		t.current, t.left = q, t.times
+	}
+	t.left--
+	return t.current, true, nil
+}
+
+func TestWorkerPoolWorkStealing(t *testing.T) {
+	t.Parallel()
+	// a single hot hostname, sticky dispatch queues every query for the same worker
+	run := func(workStealing bool) metrics.Result {
+		reader := &testRepeatReader{reader: &testQueryReader{maxCalls: 1}, times: 40}
+		wp, err := NewWithOptions(4, &testSlowClient{delay: 5 * time.Millisecond}, reader, Options{Strategy: StrategySticky, WorkStealing: workStealing})
+		assert.NoError(t, err)
+
+		result, err := wp.Run(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 40, result.NumberOfQueries)
+		return result
+	}
+
+	result := run(false)
+	assert.Equal(t, 40, result.Workers[0].Latency.NumberOfQueries)
+	assert.Equal(t, 0, result.Queue.Stolen)
+
+	result = run(true)
+	assert.True(t, result.Queue.WorkStealing)
+	assert.Positive(t, result.Queue.Stolen)
+	assert.Less(t, result.Workers[0].Latency.NumberOfQueries, 40)
+	stolen := 0
+	for _, worker := range result.Workers[1:] {
+		assert.Equal(t, worker.Stolen, worker.Latency.NumberOfQueries)
+		stolen += worker.Stolen
+	}
+	assert.Equal(t, result.Queue.Stolen, stolen)
+	assert.Equal(t, 40, result.Queue.Dispatched)
+}
+
+func TestWorkerPoolWorkStealingSkipsWarmup(t *testing.T) {
+	t.Parallel()
+	reader := &testRepeatReader{reader: &testQueryReader{maxCalls: 1}, times: 40}
+	wp, err := NewWithOptions(4, &testSlowClient{delay: 5 * time.Millisecond}, reader, Options{Strategy: StrategySticky, WorkStealing: true, WarmupQueries: 20})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 20, result.WarmupQueries)
+	assert.Equal(t, 20, result.Queue.Dispatched)
+	// stolen warmup queries are neither dispatched nor measured
+	for _, worker := range result.Workers[1:] {
+		assert.Equal(t, worker.Stolen, worker.Latency.NumberOfQueries)
+	}
+	assert.LessOrEqual(t, result.Queue.Stolen, result.Queue.Dispatched)
+}
+
+func TestNewWorkStealingSharedStrategy(t *testing.T) {
+	t.Parallel()
+	_, err := NewWithOptions(2, &testDeterministicClient{}, &testQueryReader{}, Options{Strategy: StrategyShared, WorkStealing: true})
+	assert.Error(t, err)
+	snaps.MatchSnapshot(t, err.Error())
+}
+
+func TestWorkerPoolWarmupExcludedFromMetrics(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(2, &testDeterministicClient{}, &testQueryReader{maxCalls: 15}, Options{WarmupQueries: 5})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 5, result.WarmupQueries)
+	assert.Equal(t, 10, result.NumberOfQueries)
+	assert.Equal(t, 10, result.Queue.Dispatched)
+	assert.Len(t, result.ByHost, 10)
+	// queue waits depend on how the workers are scheduled
+	result.Queue = nil
+	snaps.MatchSnapshot(t, result.Table())
+}
+
+func TestWorkerPoolDurationEndsEndlessInput(t *testing.T) {
+	t.Parallel()
+	reader := &testRepeatReader{reader: &testQueryReader{maxCalls: 1}, times: math.MaxInt}
+	options := Options{Warmup: 20 * time.Millisecond, Duration: 50 * time.Millisecond}
+	wp, err := NewWithOptions(2, &testSlowClient{delay: time.Millisecond}, reader, options)
+	assert.NoError(t, err)
 
-	worker2 := wp.getWorker(hostname2)
-	assert.NotEqual(t, worker1, worker2)
+	start := time.Now()
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.StatusCompleted, result.Status)
+	assert.GreaterOrEqual(t, time.Since(start), 70*time.Millisecond)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Positive(t, result.WarmupQueries)
+	assert.Positive(t, result.NumberOfQueries)
+}
+
+func TestNewInvalidWindow(t *testing.T) {
+	t.Parallel()
+	for _, options := range []Options{{Warmup: -time.Second}, {WarmupQueries: -1}, {Duration: -time.Second}} {
+		_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{}, options)
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+func TestWorkerPoolMaxRate(t *testing.T) {
+	t.Parallel()
+	wp, err := NewWithOptions(4, &testDeterministicClient{}, &testQueryReader{maxCalls: 20}, Options{MaxRate: 200})
+	assert.NoError(t, err)
+
+	start := time.Now()
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	// 20 queries at 200 per second, the first one is free
+	assert.GreaterOrEqual(t, time.Since(start), 19*5*time.Millisecond)
+	assert.Equal(t, 20, result.NumberOfQueries)
+	assert.Equal(t, 200.0, result.Throttle.MaxRate)
+	assert.Equal(t, 20, result.Throttle.Queries)
+	assert.Positive(t, result.Throttle.Throttled)
+	assert.Positive(t, result.Throttle.WaitTime)
+}
+
+func TestWorkerPoolMaxWorkerRate(t *testing.T) {
+	t.Parallel()
+	options := Options{Strategy: StrategyRoundRobin, MaxWorkerRate: 100}
+	wp, err := NewWithOptions(2, &testDeterministicClient{}, &testQueryReader{maxCalls: 10}, options)
+	assert.NoError(t, err)
+
+	start := time.Now()
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	// 5 queries per worker at 100 per second
+	assert.GreaterOrEqual(t, time.Since(start), 4*10*time.Millisecond)
+	assert.Equal(t, 2*4, result.Throttle.Throttled)
+	for _, worker := range result.Workers {
+		assert.Equal(t, 4, worker.Throttled)
+	}
+}
+
+func TestWorkerPoolWithoutRateLimit(t *testing.T) {
+	t.Parallel()
+	wp, err := New(2, &testDeterministicClient{}, &testQueryReader{maxCalls: 10})
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, result.Throttle)
+}
+
+func TestNewInvalidRateLimit(t *testing.T) {
+	t.Parallel()
+	for _, options := range []Options{{MaxRate: -1}, {MaxWorkerRate: -1}, {RateLimitBurst: -1}, {TargetRate: 100, MaxRate: 50}} {
+		_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{}, options)
+		assert.Error(t, err)
+		snaps.MatchSnapshot(t, err.Error())
+	}
+}
+
+// testDownClient answers the first healthy queries, then the database goes down and every query fails
+type testDownClient struct {
+	healthy int64
+	calls   atomic.Int64
+}
+
+func (t *testDownClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testDownClient) Query(_ context.Context, _ string) (*client.Response, error) {
+	if t.calls.Add(1) > t.healthy {
+		return nil, fmt.Errorf("connection refused")
+	}
+	return &client.Response{Duration: time.Millisecond}, nil
+}
+
+func TestWorkerPoolCircuitBreakerAborts(t *testing.T) {
+	t.Parallel()
+	for name, breaker := range map[string]CircuitBreaker{
+		"consecutive": {MaxConsecutiveFailures: 5},
+		"ratio":       {MaxFailureRatio: 0.5, FailureWindow: 20},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reader := &testCountingReader{reader: &testQueryReader{maxCalls: 10_000}}
+			wp, err := NewWithOptions(2, &testDownClient{healthy: 10}, reader, Options{CircuitBreaker: breaker})
+			assert.NoError(t, err)
+
+			result, err := wp.Run(context.Background())
+			assert.ErrorIs(t, err, ErrDatabaseUnhealthy)
+			assert.Equal(t, metrics.StatusAborted, result.Status)
+			assert.Equal(t, err.Error(), result.AbortReason)
+			assert.Equal(t, 10, result.NumberOfQueries)
+			assert.Positive(t, result.FailedQueries)
+			// the run stops right away instead of failing the rest of the input
+			assert.Less(t, reader.calls.Load(), int64(1000))
+			assert.Equal(t, reader.calls.Load(), int64(result.NumberOfQueries+result.FailedQueries+result.NotDispatched+result.Cancelled))
+		})
+	}
+}
+
+// testHangingClient fails the first failing queries, the next ones hang until their context is done
+type testHangingClient struct {
+	failing int64
+	calls   atomic.Int64
+}
+
+func (t *testHangingClient) Ping(_ context.Context) error {
+	return nil
+}
+
+func (t *testHangingClient) Query(ctx context.Context, _ string) (*client.Response, error) {
+	if t.calls.Add(1) <= t.failing {
+		return nil, fmt.Errorf("connection refused")
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestWorkerPoolCircuitBreakerCancelsInFlightQueries(t *testing.T) {
+	t.Parallel()
+	reader := &testCountingReader{reader: &testQueryReader{maxCalls: 1000}}
+	var done atomic.Int64
+	options := Options{QueueDepth: 2, CircuitBreaker: CircuitBreaker{MaxConsecutiveFailures: 3}, OnDone: func() { done.Add(1) }}
+	wp, err := NewWithOptions(4, &testHangingClient{failing: 3}, reader, options)
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.ErrorIs(t, err, ErrDatabaseUnhealthy)
+	// the queued queries are dropped, but every query read is done
+	assert.Equal(t, reader.calls.Load(), done.Load())
+	// the queries in flight cancelled by the breaker are not failures of the database
+	assert.Equal(t, 0, result.NumberOfQueries)
+	assert.Equal(t, 3, result.FailedQueries)
+	assert.Equal(t, reader.calls.Load(), int64(result.FailedQueries+result.NotDispatched+result.Cancelled))
+	hostFailures := 0
+	for _, host := range result.ByHost {
+		hostFailures += host.FailedQueries
+	}
+	assert.Equal(t, 3, hostFailures)
+	assert.Equal(t, 3, result.ByQueryType[string(query.TypeSingleHost)].FailedQueries)
+}
+
+func TestWorkerPoolCircuitBreakerHealthyRun(t *testing.T) {
+	t.Parallel()
+	options := Options{CircuitBreaker: CircuitBreaker{MaxFailureRatio: 0.1, MaxConsecutiveFailures: 3}}
+	wp, err := NewWithOptions(2, &testDeterministicClient{}, &testQueryReader{maxCalls: 200}, options)
+	assert.NoError(t, err)
+
+	result, err := wp.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.StatusCompleted, result.Status)
+	assert.Empty(t, result.AbortReason)
+	assert.Equal(t, 200, result.NumberOfQueries)
+}
+
+func TestNewInvalidCircuitBreaker(t *testing.T) {
+	t.Parallel()
+	_, err := NewWithOptions(1, &testDeterministicClient{}, &testQueryReader{}, Options{CircuitBreaker: CircuitBreaker{MaxFailureRatio: 2}})
+	assert.Error(t, err)
+	snaps.MatchSnapshot(t, err.Error())
 }
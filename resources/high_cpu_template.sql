@@ -0,0 +1,6 @@
+SELECT ts, usage FROM cpu_usage
+WHERE host = {{hostname}}
+  AND ts BETWEEN {{start_time:timestamp}} AND {{end_time:timestamp}}
+  AND usage > {{threshold:float}}
+ORDER BY ts DESC
+LIMIT {{limit:int}}